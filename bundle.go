@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NestedBundle indicates that a bundle lists itself or another bundle among
+// its assets. Bundles may only contain plain assets.
+var NestedBundle = errors.New("bundles cannot contain bundles")
+
+// bundles holds bundles declared with Engine.Bundle, along with the built
+// contents of every bundle.
+type bundles struct {
+	mx       sync.Mutex
+	declared map[string][]string
+	built    map[string]*builtBundle
+}
+
+// builtBundle is the concatenated contents of a bundle.
+type builtBundle struct {
+	// sig identifies the versions of the assets the bundle was built from.
+	sig    string
+	data   []byte
+	digest *assetDigest
+}
+
+// Bundle declares a bundle of assets.
+//
+// A bundle is a single asset made by concatenating other assets, in order.
+// Each of the assets is located as it is by Asset, so a theme can replace an
+// individual file in a bundle. A bundle can be used anywhere an asset can:
+// the 'asset' and 'assetSRI' template functions, Fingerprint, Integrity, and
+// AssetHandler all understand bundles. Bundles are built on first use, and
+// rebuilt when any of their assets change.
+//
+// Bundles can also be declared in theme manifests:
+//
+//	"bundles": {
+//		"app.css": ["css/reset.css", "css/main.css"]
+//	}
+//
+// When several themes declare the same bundle, the assets listed by each
+// theme are appended to those listed by the themes it overrides. A bundle
+// declared with this function replaces any bundle of the same name declared
+// in a manifest.
+//
+// A bundle may not list itself or another bundle; doing so returns an error
+// wrapping NestedBundle. Bundles declared in manifests that do so fail when
+// they are used.
+//
+// If MinifyBundles is true, CSS and JavaScript bundles are minified.
+func (e *Engine) Bundle(name string, assets ...string) error {
+	name = filepath.Clean(name)
+	if !legalName(name) || e.isTemplate(name) {
+		return IllegalName
+	}
+	n := fsName(name)
+	for _, a := range assets {
+		if an := fsName(filepath.Clean(a)); an == n {
+			return fmt.Errorf("%w: %s lists itself", NestedBundle, n)
+		} else if _, ok := e.bundleAssets(a); ok {
+			return fmt.Errorf("%w: %s lists %s", NestedBundle, n, an)
+		}
+	}
+	e.bundles.mx.Lock()
+	defer e.bundles.mx.Unlock()
+	for other, list := range e.bundles.declared {
+		if contains(list, n) || contains(list, name) {
+			return fmt.Errorf("%w: %s is listed by %s", NestedBundle, n, other)
+		}
+	}
+	e.bundles.declared[n] = assets
+	return nil
+}
+
+// bundleAssets returns the assets in the named bundle. If there is no such
+// bundle, ok is false.
+func (e *Engine) bundleAssets(name string) (assets []string, ok bool) {
+	n := fsName(filepath.Clean(name))
+	e.bundles.mx.Lock()
+	assets, ok = e.bundles.declared[n]
+	e.bundles.mx.Unlock()
+	if ok {
+		return assets, true
+	}
+
+	// Later themes are overridden by earlier ones, so their assets come
+	// first.
+	themes := e.templates().themes
+	for i := len(themes) - 1; i >= 0; i-- {
+		for _, a := range themes[i].Bundles[n] {
+			if !contains(assets, a) {
+				assets = append(assets, a)
+			}
+		}
+		if _, has := themes[i].Bundles[n]; has {
+			ok = true
+		}
+	}
+	return assets, ok
+}
+
+// bundle returns the built contents of the named bundle, building it if
+// necessary. If there is no such bundle, it returns nil.
+func (e *Engine) bundle(name string) (*builtBundle, error) {
+	assets, ok := e.bundleAssets(name)
+	if !ok {
+		return nil, nil
+	}
+
+	// The signature records which version of each asset is in the bundle,
+	// so we know when it needs to be rebuilt.
+	var sig strings.Builder
+	if e.MinifyBundles {
+		sig.WriteString("min:")
+	}
+	n := fsName(filepath.Clean(name))
+	for _, a := range assets {
+		// Members are always plain assets. Building a bundle never builds
+		// another, so a bundle that lists itself can't recurse.
+		if an := fsName(filepath.Clean(a)); an == n {
+			return nil, fmt.Errorf("%w: %s lists itself", NestedBundle, n)
+		} else if _, ok := e.bundleAssets(a); ok {
+			return nil, fmt.Errorf("%w: %s lists %s", NestedBundle, n, an)
+		}
+		dg, err := e.fileDigest(a)
+		if err != nil {
+			return nil, err
+		}
+		sig.WriteString(dg.fingerprint())
+	}
+
+	e.bundles.mx.Lock()
+	b, ok := e.bundles.built[n]
+	e.bundles.mx.Unlock()
+	if ok && b.sig == sig.String() {
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	for _, a := range assets {
+		f, err := e.OpenAsset(a)
+		if err != nil {
+			return nil, err
+		}
+		_, err = buf.ReadFrom(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		// Make sure that the last line of one asset doesn't run into the
+		// first line of the next.
+		if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+
+	data := buf.Bytes()
+	if e.MinifyBundles {
+		switch path.Ext(n) {
+		case ".css":
+			data = minifyCSS(data)
+		case ".js":
+			data = minifyJS(data)
+		}
+	}
+
+	sum := sha512.Sum384(data)
+	b = &builtBundle{
+		sig:    sig.String(),
+		data:   data,
+		digest: &assetDigest{mod: time.Time{}, size: int64(len(data)), sum: sum[:]},
+	}
+	e.bundles.mx.Lock()
+	e.bundles.built[n] = b
+	e.bundles.mx.Unlock()
+	return b, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
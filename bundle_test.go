@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"errors"
+	"io/fs"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBundle(t *testing.T) {
+	child := fstest.MapFS{
+		ManifestName:    {Data: []byte(`{"bundles": {"app.css": ["css/child.css"]}}`)},
+		"css/reset.css": {Data: []byte("/* child reset */\nhtml { margin: 0; }")},
+		"css/child.css": {Data: []byte(".child { color: pink; }\n")},
+	}
+	parent := fstest.MapFS{
+		ManifestName:    {Data: []byte(`{"bundles": {"app.css": ["css/reset.css", "css/main.css"]}}`)},
+		"css/reset.css": {Data: []byte("html { padding: 0; }")},
+		"css/main.css":  {Data: []byte("body { color: gray; }\n")},
+		"js/a.js":       {Data: []byte("var a = 1;")},
+		"js/b.js":       {Data: []byte("var b = 2;")},
+		"page.tpl":      {Data: []byte(`{{asset "app.css"}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	expect := "/* child reset */\nhtml { margin: 0; }\nbody { color: gray; }\n.child { color: pink; }\n"
+	b, err := e.bundle("app.css")
+	if err != nil {
+		t.Fatalf("Failed to build bundle: %s", err)
+	}
+	if string(b.data) != expect {
+		t.Errorf("Expected %q, got %q", expect, b.data)
+	}
+
+	fp, err := e.Fingerprint("app.css")
+	if err != nil {
+		t.Fatalf("Failed to fingerprint bundle: %s", err)
+	}
+	out, err := e.Render("page.tpl", nil)
+	if err != nil || out != "/"+fp {
+		t.Errorf("Expected %q, got %q (%v)", "/"+fp, out, err)
+	}
+
+	h := e.AssetHandler("/")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/"+fp, nil))
+	if res.Code != 200 || res.Body.String() != expect {
+		t.Errorf("Unexpected response %d %q", res.Code, res.Body.String())
+	}
+	if ct := res.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	if res.Header().Get("Cache-Control") == "" {
+		t.Error("Expected a fingerprinted bundle to be immutable")
+	}
+
+	// Minifying changes the contents, and so the fingerprint.
+	e.MinifyBundles = true
+	b, err = e.bundle("app.css")
+	if err != nil {
+		t.Fatalf("Failed to build bundle: %s", err)
+	}
+	if expect := "html{margin:0;}body{color:gray;}.child{color:pink;}"; string(b.data) != expect {
+		t.Errorf("Expected %q, got %q", expect, b.data)
+	}
+	if fp2, _ := e.Fingerprint("app.css"); fp2 == fp {
+		t.Error("Expected a new fingerprint")
+	}
+
+	// Bundles declared in Go replace those in manifests.
+	if err := e.Bundle("app.css", "css/main.css"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Bundle("all.js", "js/a.js", "js/b.js"); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]string{
+		"app.css": "body{color:gray;}",
+		"all.js":  "var a = 1;\nvar b = 2;",
+	}
+	for name, expect := range data {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest("GET", "/"+name, nil))
+		if res.Code != 200 || res.Body.String() != expect {
+			t.Errorf("Unexpected response for %s: %d %q", name, res.Code, res.Body.String())
+		}
+	}
+
+	if err := e.Bundle("broken.js", "js/nope.js"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Fingerprint("broken.js"); err != NoAssetFound {
+		t.Errorf("Expected NoAssetFound, got %v", err)
+	}
+	if err := e.Bundle("../x.js", "js/a.js"); err != IllegalName {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+}
+
+func TestNestedBundle(t *testing.T) {
+	mem := fstest.MapFS{
+		"app.css":    {Data: []byte(`app`)},
+		"reset.css":  {Data: []byte(`reset`)},
+		"theme.json": {Data: []byte(`{"bundles": {"app.css": ["reset.css", "app.css"], "all.css": ["site.css"], "site.css": ["reset.css"]}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	// These used to recurse until the stack overflowed.
+	for _, name := range []string{"app.css", "all.css"} {
+		if _, err := e.Fingerprint(name); !errors.Is(err, NestedBundle) {
+			t.Errorf("Expected NestedBundle for %s, got %v", name, err)
+		}
+		res := httptest.NewRecorder()
+		e.AssetHandler("/").ServeHTTP(res, httptest.NewRequest("GET", "/"+name, nil))
+		if res.Code != 500 {
+			t.Errorf("Expected 500 for %s, got %d", name, res.Code)
+		}
+	}
+
+	if err := e.Bundle("app.css", "reset.css", "app.css"); !errors.Is(err, NestedBundle) {
+		t.Errorf("Expected NestedBundle, got %v", err)
+	}
+	if err := e.Bundle("x.css", "site.css"); !errors.Is(err, NestedBundle) {
+		t.Errorf("Expected NestedBundle, got %v", err)
+	}
+	if err := e.Bundle("y.css", "reset.css"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Bundle("reset.css", "app.css"); !errors.Is(err, NestedBundle) {
+		t.Errorf("Expected NestedBundle for a bundle that another lists, got %v", err)
+	}
+}
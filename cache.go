@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCacheSize is the number of entries held by the cache that each new
+// Engine uses for RenderCached.
+var DefaultCacheSize = 1000
+
+// Cache stores rendered output for RenderCached.
+//
+// Implementations must be safe for concurrent use. A Cache may forget
+// entries whenever it likes.
+type Cache interface {
+	// Get returns the value stored under key, if it is present and has not
+	// expired.
+	Get(key string) (string, bool)
+	// Set stores a value under key. If ttl is greater than zero, the value
+	// expires after that long.
+	Set(key, value string, ttl time.Duration)
+}
+
+// CacheStats counts the lookups made by RenderCached.
+type CacheStats struct {
+	Hits, Misses uint64
+}
+
+// RenderCached renders a template, reusing the output of an earlier call with
+// the same name and key for up to ttl.
+//
+// This is meant for templates that are expensive to render and whose output
+// depends only on the key, such as menus and footers. The key must identify
+// the data: calls with the same name and key are assumed to produce the same
+// output, whatever their data. If ttl is less than or equal to zero, the
+// output is kept for as long as the cache holds it.
+//
+// Output is stored in e.Cache, which by default holds DefaultCacheSize
+// entries and forgets the least recently used ones first. When templates are
+// reloaded, earlier output is no longer used, and output from Debug mode is
+// only used in Debug mode. Failed renders are not cached.
+//
+// A Cache may be shared by several engines, or outlive the process. Every
+// engine stores its output under keys that begin with an ID chosen at random
+// when the engine is created, so engines never see each other's output, and
+// output stored by an earlier process is never used.
+func (e *Engine) RenderCached(name, key string, ttl time.Duration, data interface{}) (string, error) {
+	set := e.templates()
+	// Output from Debug mode differs, so it is kept apart.
+	ck := e.id + "\x00" + strconv.FormatUint(set.gen, 10) + "\x00" + strconv.FormatBool(e.Debug) +
+		"\x00" + name + "\x00" + key
+	if out, ok := e.Cache.Get(ck); ok {
+		atomic.AddUint64(&e.hits, 1)
+		return out, nil
+	}
+	atomic.AddUint64(&e.misses, 1)
+
+	sp, tkey, err := e.lookupView(set, name)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = e.executePage(&buf, set, sp, sp.master, tkey, data, nil)
+	if err := e.renderError(set, sp, name, tkey, err); err != nil {
+		return "", err
+	}
+	out := buf.String()
+	e.Cache.Set(ck, out, ttl)
+	return out, nil
+}
+
+// newID returns a random ID for an engine.
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Without randomness, fall back on the time, which is unique
+		// enough within a process.
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// CacheStats returns the number of times that RenderCached has found output
+// in the cache, and the number of times it hasn't.
+func (e *Engine) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&e.hits),
+		Misses: atomic.LoadUint64(&e.misses),
+	}
+}
+
+// LRUCache is an in-memory Cache that holds a limited number of entries,
+// forgetting the least recently used first.
+type LRUCache struct {
+	size int
+
+	mx      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key, value string
+	expires    time.Time
+}
+
+// NewLRUCache creates an LRUCache that holds up to size entries.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *LRUCache) Get(key string) (string, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	ent := el.Value.(*lruEntry)
+	if !ent.expires.IsZero() && time.Now().After(ent.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return ent.value, true
+}
+
+func (c *LRUCache) Set(key, value string, ttl time.Duration) {
+	ent := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		ent.expires = time.Now().Add(ttl)
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = ent
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(ent)
+	for c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.entries, el.Value.(*lruEntry).key)
+	}
+}
+
+// Len returns the number of entries in the cache, including any that have
+// expired but not yet been removed.
+func (c *LRUCache) Len() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestRenderCached(t *testing.T) {
+	mem := fstest.MapFS{
+		"menu.tpl": {Data: []byte(`menu:{{.}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	expect := func(key, data, out string) {
+		t.Helper()
+		res, err := e.RenderCached("menu.tpl", key, 0, data)
+		if err != nil {
+			t.Errorf("Failed render: %s", err)
+		}
+		if res != out {
+			t.Errorf("Expected %q, got %q", out, res)
+		}
+	}
+	expect("a", "one", "menu:one")
+	// The key, not the data, identifies the output.
+	expect("a", "two", "menu:one")
+	expect("b", "two", "menu:two")
+	if s := e.CacheStats(); s.Hits != 1 || s.Misses != 2 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	// Reloading invalidates earlier output.
+	mem["menu.tpl"] = &fstest.MapFile{Data: []byte(`new:{{.}}`)}
+	if err := e.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %s", err)
+	}
+	expect("a", "three", "new:three")
+
+	// Debug output is kept apart from the rest.
+	e.Debug = true
+	expect("a", "four", "<!-- engine: fs0/menu.tpl -->new:four<!-- /engine: fs0/menu.tpl -->")
+	e.Debug = false
+	expect("a", "five", "new:three")
+
+	if _, err := e.RenderCached("nope.tpl", "a", 0, nil); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(2)
+	c.Set("a", "1", 0)
+	c.Set("b", "2", 0)
+	c.Get("a")
+	// b is the least recently used.
+	c.Set("c", "3", 0)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("Expected %s to be cached", k)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+
+	c.Set("a", "4", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if v, ok := c.Get("a"); ok {
+		t.Errorf("Expected a to expire, got %q", v)
+	}
+
+	// Concurrent use is safe.
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			for j := 0; j < 100; j++ {
+				k := fmt.Sprint(i, j%3)
+				c.Set(k, k, time.Minute)
+				c.Get(k)
+			}
+			done <- true
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+}
+
+func TestSharedCache(t *testing.T) {
+	cache := NewLRUCache(10)
+	var engines []*Engine
+	for _, name := range []string{"A", "B"} {
+		mem := fstest.MapFS{"menu.tpl": {Data: []byte(name)}}
+		e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to load templates: %s", err)
+		}
+		e.Cache = cache
+		engines = append(engines, e)
+	}
+	for i, expect := range []string{"A", "B", "A", "B"} {
+		out, err := engines[i%2].RenderCached("menu.tpl", "k", 0, nil)
+		if err != nil || out != expect {
+			t.Errorf("Expected %q, got %q (%v)", expect, out, err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+}
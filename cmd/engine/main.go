@@ -0,0 +1,330 @@
+// Command engine inspects and renders themes from the command line.
+//
+// Usage:
+//
+//	engine list THEME...
+//	engine render [-data FILE] NAME THEME...
+//	engine check [-lint] THEME...
+//	engine export -routes FILE [-out DIR] [-prefix URL] THEME...
+//
+// Themes are given in search order, so the first theme takes precedence.
+//
+// The list command shows every template and asset, the theme that supplies
+// it, and the themes that it overrides.
+//
+// The render command renders the named template to standard output. Data
+// for the template is read from a JSON or YAML file; YAML is assumed if the
+// file name ends in .yaml or .yml.
+//
+// The check command parses every template, and checks the HTML templates
+// with Engine.Check, and reports any errors. It exits
+// with a non-zero status if there are any, which makes it suitable for use
+// in pre-commit hooks. With -lint, problems found by Engine.Lint are
+// reported too, and also cause a non-zero exit status.
+//
+// The export command writes a static copy of a site with Engine.Export. The
+// routes file is a JSON or YAML object that maps each URL path to the page
+// to render there:
+//
+//	{
+//		"/": {"template": "home.tpl", "data": {"title": "Home"}},
+//		"/docs/": {"template": "docs.tpl", "layout": "layouts/main.tpl"}
+//	}
+//
+// Assets are exported under the path of the -prefix URL, which is used in
+// asset URLs too.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Masterminds/engine"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `usage:
+	engine list THEME...
+	engine render [-data FILE] NAME THEME...
+	engine check [-lint] THEME...
+	engine export -routes FILE [-out DIR] [-prefix URL] THEME...
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// command runs a subcommand, returning an error to report.
+type command func(args []string, stdout io.Writer) error
+
+var commands = map[string]command{
+	"list":   list,
+	"render": render,
+	"check":  check,
+	"export": export,
+}
+
+// errUsage indicates that a command was given bad arguments.
+var errUsage = errors.New("bad arguments")
+
+// run runs the command given by args and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "engine: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+	if err := cmd(args[1:], stdout); err != nil {
+		if err == errUsage || err == flag.ErrHelp {
+			fmt.Fprint(stderr, usage)
+			return 2
+		}
+		fmt.Fprintf(stderr, "engine: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseFlags parses args with fs, allowing flags to be mixed in with the
+// other arguments, which are returned.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// newFlagSet returns a flag set that reports errors rather than printing
+// them.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func list(args []string, stdout io.Writer) error {
+	themes, err := parseFlags(newFlagSet("list"), args)
+	if err != nil {
+		return err
+	}
+	if len(themes) == 0 {
+		return errUsage
+	}
+	e, err := engine.New(themes...)
+	if err != nil {
+		return err
+	}
+
+	// Gather the distinct names supplied by any theme.
+	templates := map[string]bool{}
+	assets := map[string]bool{}
+	for _, d := range e.Dirs() {
+		err := filepath.WalkDir(d, func(p string, de fs.DirEntry, err error) error {
+			if err != nil || de.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(d, p)
+			if err != nil {
+				return err
+			}
+			if rel == engine.ManifestName {
+				return nil
+			}
+			if _, err := e.ResolveAsset(rel); err == engine.IllegalName {
+				templates[rel] = true
+			} else {
+				assets[rel] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tTHEME\tOVERRIDES")
+	for _, kind := range []struct {
+		name    string
+		names   map[string]bool
+		resolve func(string) ([]engine.Candidate, error)
+	}{
+		{"template", templates, e.Resolve},
+		{"asset", assets, e.ResolveAsset},
+	} {
+		for _, n := range sortedKeys(kind.names) {
+			cands, err := kind.resolve(n)
+			if err != nil {
+				// Files with other extensions are neither templates nor
+				// assets.
+				continue
+			}
+			var owner string
+			var overrides []string
+			for _, c := range cands {
+				switch {
+				case c.Chosen:
+					owner = c.Theme
+				case c.Exists:
+					overrides = append(overrides, c.Theme)
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", kind.name, filepath.ToSlash(n), owner, strings.Join(overrides, ", "))
+		}
+	}
+	return w.Flush()
+}
+
+func render(args []string, stdout io.Writer) error {
+	fs := newFlagSet("render")
+	dataFile := fs.String("data", "", "a JSON or YAML file of data for the template")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	var data interface{}
+	if *dataFile != "" {
+		if data, err = readData(*dataFile); err != nil {
+			return err
+		}
+	}
+
+	e, err := engine.New(args[1:]...)
+	if err != nil {
+		return err
+	}
+	return e.RenderTo(stdout, args[0], data)
+}
+
+func check(args []string, stdout io.Writer) error {
+	fs := newFlagSet("check")
+	lint := fs.Bool("lint", false, "also report problems found by Engine.Lint")
+	themes, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(themes) == 0 {
+		return errUsage
+	}
+	e, err := engine.New(themes...)
+	if err != nil {
+		return err
+	}
+	problems := 0
+	for _, err := range e.Check() {
+		fmt.Fprintln(stdout, err)
+		problems++
+	}
+	if *lint {
+		diags, err := e.Lint()
+		if err != nil {
+			return err
+		}
+		for _, d := range diags {
+			fmt.Fprintln(stdout, d)
+		}
+		problems += len(diags)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problems found", problems)
+	}
+	fmt.Fprintf(stdout, "ok: %s\n", strings.Join(e.Dirs(), ", "))
+	return nil
+}
+
+func export(args []string, stdout io.Writer) error {
+	fs := newFlagSet("export")
+	routesFile := fs.String("routes", "", "a JSON or YAML file of routes to export")
+	out := fs.String("out", "public", "the directory to write to")
+	prefix := fs.String("prefix", "/", "the URL prefix for assets")
+	themes, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(themes) == 0 || *routesFile == "" {
+		return errUsage
+	}
+
+	// The routes are decoded generically, so that they may be YAML, and
+	// then converted.
+	data, err := readData(*routesFile)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var routes map[string]engine.RenderSpec
+	if err := json.Unmarshal(b, &routes); err != nil {
+		return fmt.Errorf("could not read %s: %s", *routesFile, err)
+	}
+
+	e, err := engine.New(themes...)
+	if err != nil {
+		return err
+	}
+	e.AssetPrefix = *prefix
+	sum, err := e.Export(*out, routes)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "exported %d pages and %d assets (%d bytes) to %s\n", len(sum.Pages), len(sum.Assets), sum.Bytes, *out)
+	return nil
+}
+
+// readData reads template data from a JSON or YAML file.
+func readData(name string) (interface{}, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", name, err)
+		}
+		return data, nil
+	default:
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", name, err)
+		}
+		return data, nil
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
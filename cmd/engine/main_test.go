@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree writes files into a new temporary directory.
+func writeTree(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	child := writeTree(t, map[string]string{
+		"main.tpl": `Hello {{.name}}{{range .tags}} {{.}}{{end}}`,
+		"site.css": `body{}`,
+	})
+	parent := writeTree(t, map[string]string{
+		"main.tpl":     `parent`,
+		"footer.tpl":   `footer`,
+		"site.css":     `body{}`,
+		"theme.json":   `{"name": "parent"}`,
+		"images/a.png": `png`,
+	})
+	data := writeTree(t, map[string]string{
+		"data.json":   `{"name": "JSON", "tags": ["a", "b"]}`,
+		"data.yaml":   "name: YAML\ntags:\n  - c\n",
+		"routes.yaml": "/:\n  template: main.tpl\n  data:\n    name: Export\n",
+	})
+	out := filepath.Join(t.TempDir(), "public")
+	dup := writeTree(t, map[string]string{
+		"footer.tpl": `footer`,
+	})
+	broken := writeTree(t, map[string]string{
+		"bad.tpl": `{{if}}`,
+	})
+	unescaped := writeTree(t, map[string]string{
+		"attr.tpl":   `<a href="{{.}}`,
+		"branch.tpl": `{{if .}}<b>{{else}}<i{{end}}`,
+	})
+
+	tests := []struct {
+		args   []string
+		status int
+		out    []string
+	}{
+		{[]string{"list", child, parent}, 0, []string{
+			"template  footer.tpl",
+			"template  main.tpl",
+			"asset     images/a.png",
+			"asset     site.css",
+		}},
+		{[]string{"render", "main.tpl", child, parent, "-data", filepath.Join(data, "data.json")}, 0, []string{"Hello JSON a b"}},
+		{[]string{"render", "--data", filepath.Join(data, "data.yaml"), "main.tpl", child}, 0, []string{"Hello YAML c"}},
+		{[]string{"render", "footer.tpl", child, parent}, 0, []string{"footer"}},
+		{[]string{"render", "nope.tpl", child}, 1, nil},
+		{[]string{"render", "main.tpl"}, 2, nil},
+		{[]string{"check", child, parent}, 0, []string{"ok"}},
+		{[]string{"check", child, broken}, 1, nil},
+		{[]string{"check", unescaped, parent}, 1, []string{"rendering attr.tpl", "rendering branch.tpl"}},
+		{[]string{"check", "-lint", dup, parent}, 1, []string{"footer.tpl: identical to"}},
+		{[]string{"check", "-lint", parent}, 0, []string{"ok"}},
+		{[]string{"export", "-routes", filepath.Join(data, "routes.yaml"), "-out", out, child, parent}, 0, []string{"exported 1 pages and 4 assets"}},
+		{[]string{"export", child}, 2, nil},
+		{[]string{"nope"}, 2, nil},
+		{nil, 2, nil},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if status := run(tt.args, &stdout, &stderr); status != tt.status {
+			t.Errorf("%v: expected status %d, got %d (%s)", tt.args, tt.status, status, stderr.String())
+		}
+		for _, o := range tt.out {
+			if !strings.Contains(stdout.String(), o) {
+				t.Errorf("%v: expected output to contain %q, got %q", tt.args, o, stdout.String())
+			}
+		}
+	}
+
+	if b, err := os.ReadFile(filepath.Join(out, "index.html")); err != nil || string(b) != "Hello Export" {
+		t.Errorf("Expected an exported page, got %q (%v)", b, err)
+	}
+
+	// The list shows which theme owns each file and what it overrides.
+	var stdout bytes.Buffer
+	run([]string{"list", child, parent}, &stdout, &stdout)
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		f := strings.Fields(line)
+		if len(f) > 1 && f[1] == "main.tpl" && (len(f) != 4 || f[2] != child || f[3] != parent) {
+			t.Errorf("Expected main.tpl to be owned by %s and override %s, got %q", child, parent, line)
+		}
+	}
+}
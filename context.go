@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"sync"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// RenderContext renders a template, giving up if the context is done.
+//
+// Templates are located exactly as they are by Render. If the context is
+// cancelled or its deadline passes before the template finishes, the error
+// returned wraps ctx.Err() and names the template:
+//
+//	out, err := e.RenderContext(ctx, "main.tpl", data)
+//	if errors.Is(err, context.DeadlineExceeded) {
+//		// ...
+//	}
+//
+// Template functions can opt in to receiving the context by taking a
+// context.Context as their first parameter. Templates call these functions
+// without the context, which the engine supplies. When rendered by anything
+// other than RenderContext or RenderContextTo, they receive
+// context.Background(). Note that binding the context requires a fresh copy
+// of the templates for every call, so using such functions makes
+// RenderContext more expensive.
+func (e *Engine) RenderContext(ctx context.Context, name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := e.RenderContextTo(ctx, &buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RenderContextTo renders a template to w, giving up if the context is done.
+//
+// It is the streaming counterpart of RenderContext. Once the context is
+// done, nothing more is written to w, even if the template is still
+// executing in the background.
+func (e *Engine) RenderContextTo(ctx context.Context, w io.Writer, name string, data interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	set := e.templates()
+	sp, key, err := e.lookupView(set, name)
+	if err != nil {
+		return err
+	}
+
+	t := sp.master
+	var bound template.FuncMap
+	if len(e.ctxFuncs) > 0 {
+		if t, err = sp.proto.Clone(); err != nil {
+			return err
+		}
+		bound = e.bindContext(ctx)
+		t.Funcs(bound)
+	}
+
+	cw := &contextWriter{ctx: ctx, w: w}
+	done := make(chan error, 1)
+	go func() {
+		done <- e.executePage(cw, set, sp, t, key, data, bound)
+	}()
+
+	select {
+	case err := <-done:
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %w", name, ctx.Err())
+		}
+		return e.renderError(set, sp, name, key, err)
+	case <-ctx.Done():
+		cw.close()
+		return fmt.Errorf("%s: %w", name, ctx.Err())
+	}
+}
+
+// contextWriter stops writing once its context is done.
+type contextWriter struct {
+	ctx    context.Context
+	mx     sync.Mutex
+	closed bool
+	w      io.Writer
+}
+
+func (c *contextWriter) Write(p []byte) (int, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.closed {
+		return 0, c.ctx.Err()
+	}
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
+
+// close prevents any further writes.
+func (c *contextWriter) close() {
+	c.mx.Lock()
+	c.closed = true
+	c.mx.Unlock()
+}
+
+// contextFuncs finds the functions in funcs that take a context.Context as
+// their first parameter. Each is replaced in funcs by a function bound to
+// context.Background(), and the originals are returned.
+func contextFuncs(funcs template.FuncMap) map[string]reflect.Value {
+	res := map[string]reflect.Value{}
+	for name, fn := range funcs {
+		v := reflect.ValueOf(fn)
+		if v.Kind() != reflect.Func || v.Type().NumIn() == 0 || v.Type().In(0) != contextType {
+			continue
+		}
+		res[name] = v
+		funcs[name] = bindContext(v, context.Background())
+	}
+	return res
+}
+
+// bindContext returns copies of the engine's context functions bound to ctx.
+func (e *Engine) bindContext(ctx context.Context) template.FuncMap {
+	funcs := make(template.FuncMap, len(e.ctxFuncs))
+	for name, fn := range e.ctxFuncs {
+		funcs[name] = bindContext(fn, ctx)
+	}
+	return funcs
+}
+
+// bindContext returns a function that calls fn with ctx as its first
+// argument, followed by its own arguments.
+func bindContext(fn reflect.Value, ctx context.Context) interface{} {
+	ft := fn.Type()
+	in := make([]reflect.Type, ft.NumIn()-1)
+	for i := range in {
+		in[i] = ft.In(i + 1)
+	}
+	out := make([]reflect.Type, ft.NumOut())
+	for i := range out {
+		out[i] = ft.Out(i)
+	}
+
+	c := reflect.ValueOf(&ctx).Elem()
+	bound := reflect.MakeFunc(reflect.FuncOf(in, out, ft.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+		args = append([]reflect.Value{c}, args...)
+		if ft.IsVariadic() {
+			return fn.CallSlice(args)
+		}
+		return fn.Call(args)
+	})
+	return bound.Interface()
+}
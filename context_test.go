@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type ctxKey string
+
+func TestRenderContext(t *testing.T) {
+	mem := fstest.MapFS{
+		"user.tpl":   {Data: []byte(`{{user}}:{{.}}`)},
+		"wait.tpl":   {Data: []byte(`before{{wait}}after`)},
+		"sleep.tpl":  {Data: []byte(`{{sleep}}`)},
+		"join.tpl":   {Data: []byte(`{{join "a" "b"}}`)},
+		"page.tpl":   {Data: []byte("---\nlayout: layout.tpl\n---\n{{define \"content\"}}{{user}}{{end}}")},
+		"page.md":    {Data: []byte("---\nlayout: layout.tpl\n---\n{{user}}")},
+		"layout.tpl": {Data: []byte(`<main>{{block "content" .}}{{end}}</main>`)},
+	}
+	funcs := template.FuncMap{
+		"user": func(ctx context.Context) string {
+			if u, ok := ctx.Value(ctxKey("user")).(string); ok {
+				return u
+			}
+			return "nobody"
+		},
+		"wait": func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+		"join": func(ctx context.Context, parts ...string) string {
+			return strings.Join(parts, "-")
+		},
+		"sleep": func() string {
+			time.Sleep(time.Second)
+			return "slept"
+		},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, funcs, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKey("user"), "matt")
+	out, err := e.RenderContext(ctx, "user.tpl", "test")
+	if err != nil || out != "matt:test" {
+		t.Errorf("Expected 'matt:test', got %q (%v)", out, err)
+	}
+
+	// Without a context, functions get context.Background().
+	out, err = e.Render("user.tpl", "test")
+	if err != nil || out != "nobody:test" {
+		t.Errorf("Expected 'nobody:test', got %q (%v)", out, err)
+	}
+
+	// Layouts from front matter see the context too, before and after the
+	// cached layout has been used.
+	for i := 0; i < 2; i++ {
+		for name, expect := range map[string]string{
+			"page.tpl": "<main>matt</main>",
+			"page.md":  "<main><p>matt</p>\n</main>",
+		} {
+			out, err = e.RenderContext(ctx, name, nil)
+			if err != nil || out != expect {
+				t.Errorf("Expected %q, got %q (%v)", expect, out, err)
+			}
+			if out, _ := e.Render(name, nil); !strings.Contains(out, "nobody") {
+				t.Errorf("Expected nobody without a context, got %q", out)
+			}
+		}
+	}
+
+	out, err = e.RenderContext(ctx, "join.tpl", nil)
+	if err != nil || out != "a-b" {
+		t.Errorf("Expected 'a-b', got %q (%v)", out, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = e.RenderContext(ctx, "wait.tpl", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "wait.tpl") {
+		t.Errorf("Expected the error to name the template, got %q", err)
+	}
+
+	// Functions that don't take a context can't be interrupted, but the
+	// render still returns when the context is done.
+	ctx, cancel = context.WithCancel(context.Background())
+	start := time.Now()
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = e.RenderContext(ctx, "sleep.tpl", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Canceled, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Expected RenderContext to return promptly")
+	}
+
+	if _, err := e.RenderContext(ctx, "user.tpl", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Canceled, got %v", err)
+	}
+	if _, err := e.RenderContext(context.Background(), "nope.tpl", nil); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"html/template"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// debugFunc is the template function that writes the comments around
+// {{template}} calls in Debug mode. Templates can't call it, since it is not
+// among the functions they are parsed with.
+const debugFunc = "_engine_debug"
+
+// rawElements are the HTML elements whose content is not markup, and so
+// can't hold a comment.
+var rawElements = []string{"script", "style", "textarea", "title"}
+
+// lookupView is lookup for templates that are about to be executed. In Debug
+// mode, HTML templates come from a copy of their space in which the output of
+// every {{template}} call is surrounded by comments naming the template
+// called. See debugTree.
+func (e *Engine) lookupView(set *templateSet, name string) (*space, string, error) {
+	sp, key, err := e.lookup(set, name)
+	if err != nil || !e.Debug || sp.text || sp.debug {
+		return sp, key, err
+	}
+
+	sp.debugOnce.Do(func() {
+		sp.debugView, sp.debugErr = sp.newDebugView()
+	})
+	return sp.debugView, key, sp.debugErr
+}
+
+// newDebugView builds the copy of s used in Debug mode.
+func (s *space) newDebugView() (*space, error) {
+	proto, err := s.proto.Clone()
+	if err != nil {
+		return nil, err
+	}
+	proto.Funcs(template.FuncMap{
+		debugFunc: func(comment string) template.HTML { return template.HTML(comment) },
+	})
+	for name, tree := range proto.trees() {
+		if err := proto.AddParseTree(name, debugTree(tree)); err != nil {
+			return nil, err
+		}
+	}
+
+	master, err := proto.Clone()
+	if err != nil {
+		return nil, err
+	}
+	v := newSpace(master, false)
+	v.named = s.named
+	v.proto = proto
+	v.debug = true
+	return v, nil
+}
+
+// debugTree returns a copy of tree in which each {{template}} call is
+// surrounded by calls to debugFunc.
+//
+// Calls inside a tag, a comment, or an element such as <script> are left
+// alone, since a comment there would be escaped, or would change what the
+// page does. Where they are is only estimated from the text around them.
+func debugTree(tree *parse.Tree) *parse.Tree {
+	tree = tree.Copy()
+
+	marked := map[*parse.TemplateNode]bool{}
+	var st markupState
+	walkNodes(tree.Root, func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.TextNode:
+			st = st.next(string(n.Text))
+		case *parse.TemplateNode:
+			marked[n] = st.in == inText
+		}
+	})
+
+	walkNodes(tree.Root, func(n parse.Node) {
+		list, ok := n.(*parse.ListNode)
+		if !ok {
+			return
+		}
+		nodes := make([]parse.Node, 0, len(list.Nodes))
+		for _, c := range list.Nodes {
+			tn, ok := c.(*parse.TemplateNode)
+			if !ok || !marked[tn] {
+				nodes = append(nodes, c)
+				continue
+			}
+			label := commentSafe(tn.Name)
+			nodes = append(nodes,
+				debugAction(tn, "<!-- engine: "+label+" -->"),
+				tn,
+				debugAction(tn, "<!-- /engine: "+label+" -->"))
+		}
+		list.Nodes = nodes
+	})
+	return tree
+}
+
+// debugAction returns an action that writes comment, placed at the call n.
+func debugAction(n *parse.TemplateNode, comment string) *parse.ActionNode {
+	fn := parse.NewIdentifier(debugFunc).SetPos(n.Pos)
+	arg := &parse.StringNode{
+		NodeType: parse.NodeString,
+		Pos:      n.Pos,
+		Quoted:   strconv.Quote(comment),
+		Text:     comment,
+	}
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      n.Pos,
+		Line:     n.Line,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      n.Pos,
+			Line:     n.Line,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{fn, arg},
+			}},
+		},
+	}
+}
+
+// commentSafe makes s safe to put in an HTML comment by making sure it
+// can't end the comment early.
+func commentSafe(s string) string {
+	return strings.Replace(s, "--", "- -", -1)
+}
+
+// markup is the part of an HTML document that output is in.
+type markup int
+
+const (
+	inText markup = iota
+	inTag
+	inComment
+	inRaw
+)
+
+// markupState tracks where text leaves an HTML document.
+type markupState struct {
+	in markup
+	// end is the closing tag of the raw element being read or entered,
+	// like "</script".
+	end string
+}
+
+// next returns the state after text.
+func (st markupState) next(text string) markupState {
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch st.in {
+		case inText:
+			if strings.HasPrefix(rest, "<!--") {
+				st.in = inComment
+				i += len("<!--")
+				continue
+			}
+			if len(rest) > 1 && rest[0] == '<' && (rest[1] == '/' || isLetter(rest[1])) {
+				st.in = inTag
+				for _, el := range rawElements {
+					if hasPrefixFold(rest[1:], el) {
+						st.end = "</" + el
+					}
+				}
+			}
+		case inTag:
+			if rest[0] == '>' {
+				st.in = inText
+				if st.end != "" {
+					st.in = inRaw
+				}
+			}
+		case inComment:
+			if strings.HasPrefix(rest, "-->") {
+				st.in = inText
+				i += len("-->")
+				continue
+			}
+		case inRaw:
+			if hasPrefixFold(rest, st.end) {
+				st.in = inTag
+				i += len(st.end)
+				st.end = ""
+				continue
+			}
+		}
+		i++
+	}
+	return st
+}
+
+// hasPrefixFold is strings.HasPrefix, ignoring case.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// EmailSubject is the name of the template that supplies an email's subject.
+var EmailSubject = "subject"
+
+// Email is a rendered email. See RenderEmail.
+type Email struct {
+	// Header holds the message headers. RenderEmail sets Subject and
+	// MIME-Version; other headers, such as From and To, are up to the
+	// caller.
+	Header textproto.MIMEHeader
+	// Subject is the rendered subject.
+	Subject string
+	// Text and HTML are the rendered bodies. Either may be empty if the
+	// template for it does not exist.
+	Text, HTML string
+}
+
+// RenderEmail renders an email from a pair of templates.
+//
+// The templates are located the same way as Render locates them, using the
+// name with ".html" and ".txt" added before the template extension. So with
+// the default extension, RenderEmail("welcome", data) renders welcome.html.tpl
+// and welcome.txt.tpl. The text template is rendered without HTML escaping.
+// Either template may be missing, but not both.
+//
+// The subject comes from a template named by EmailSubject that is defined in
+// the text template, or failing that, in the HTML template:
+//
+//	{{define "subject"}}Welcome, {{.Name}}!{{end}}
+//
+// Like layouts, each email uses its own definitions, so every email can
+// define a subject.
+//
+// If EmailStyle is set, the stylesheet it names is added to the HTML in a
+// <style> element.
+func (e *Engine) RenderEmail(name string, data interface{}) (*Email, error) {
+	m := &Email{Header: textproto.MIMEHeader{}}
+	found := false
+	var htmlSubject string
+	for _, part := range []struct {
+		kind    string
+		body    *string
+		subject *string
+	}{
+		{".txt", &m.Text, &m.Subject},
+		{".html", &m.HTML, &htmlSubject},
+	} {
+		ok, err := e.renderEmailPart(name+part.kind, data, part.body, part.subject)
+		if err != nil {
+			return nil, err
+		}
+		found = found || ok
+	}
+	if !found {
+		return nil, NoTemplateFound
+	}
+
+	if m.Subject == "" {
+		m.Subject = html.UnescapeString(htmlSubject)
+	}
+	m.Subject = strings.TrimSpace(m.Subject)
+
+	if e.EmailStyle != "" && m.HTML != "" {
+		css, err := e.assetData(e.EmailStyle)
+		if err != nil {
+			return nil, err
+		}
+		m.HTML = addStyle(m.HTML, string(css))
+	}
+
+	m.Header.Set("MIME-Version", "1.0")
+	m.Header.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	return m, nil
+}
+
+// renderEmailPart renders the first template named base plus one of the
+// template extensions, and its subject. It returns false if there is no
+// such template.
+func (e *Engine) renderEmailPart(base string, data interface{}, body, subject *string) (bool, error) {
+	set := e.templates()
+	var sp *space
+	var key string
+	for _, ext := range set.exts {
+		var err error
+		if sp, key, err = e.lookup(set, base+ext); err == nil {
+			break
+		}
+	}
+	if sp == nil {
+		return false, nil
+	}
+
+	// As with layouts, the email's own definitions take precedence.
+	src := set.sources[key]
+	t, err := sp.layout(key, src, e.funcs)
+	if err != nil {
+		return true, err
+	}
+
+	var buf bytes.Buffer
+	if err := e.execute(&buf, t, key, data, ""); err != nil {
+		return true, e.renderError(set, sp, base, key, err)
+	}
+	*body = buf.String()
+
+	trees, err := parseTrees(key, src, e.funcs)
+	if err != nil {
+		return true, err
+	}
+	if _, ok := trees[EmailSubject]; ok {
+		buf.Reset()
+		if err := e.execute(&buf, t, EmailSubject, data, ""); err != nil {
+			return true, e.renderError(set, sp, base, key, err)
+		}
+		*subject = buf.String()
+	}
+	return true, nil
+}
+
+// addStyle adds a stylesheet to an HTML document, in the head if there is
+// one.
+func addStyle(doc, css string) string {
+	style := "<style>\n" + css + "\n</style>\n"
+	if i := strings.Index(strings.ToLower(doc), "</head>"); i >= 0 {
+		return doc[:i] + style + doc[i:]
+	}
+	return style + doc
+}
+
+// Bytes returns the complete message, with headers, in a form that can be
+// passed to smtp.SendMail.
+//
+// If the email has both a text and an HTML body, it is sent as
+// multipart/alternative, so that mail clients can choose between them.
+func (m *Email) Bytes() []byte {
+	var buf bytes.Buffer
+
+	h := textproto.MIMEHeader{}
+	for k, v := range m.Header {
+		h[k] = v
+	}
+
+	var mw *multipart.Writer
+	switch {
+	case m.Text != "" && m.HTML != "":
+		mw = multipart.NewWriter(&buf)
+		h.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	case m.HTML != "":
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+	default:
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+	}
+
+	var head bytes.Buffer
+	writeHeader(&head, h)
+	head.WriteString("\r\n")
+
+	if mw == nil {
+		body := m.Text
+		if m.HTML != "" {
+			body = m.HTML
+		}
+		writeQuoted(&buf, body)
+		return append(head.Bytes(), buf.Bytes()...)
+	}
+
+	// The last part is the preferred one.
+	for _, part := range []struct{ typ, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.typ},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			// Writes to a bytes.Buffer do not fail.
+			panic(err)
+		}
+		writeQuoted(w, part.body)
+	}
+	mw.Close()
+	return append(head.Bytes(), buf.Bytes()...)
+}
+
+// writeHeader writes h in a stable order.
+func writeHeader(buf *bytes.Buffer, h textproto.MIMEHeader) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+		}
+	}
+}
+
+// writeQuoted writes s to w with quoted-printable encoding.
+func writeQuoted(w io.Writer, s string) {
+	qw := quotedprintable.NewWriter(w)
+	qw.Write([]byte(s))
+	qw.Close()
+}
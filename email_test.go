@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderEmail(t *testing.T) {
+	child := fstest.MapFS{
+		"mail/welcome.txt.tpl":   {Data: []byte(`{{define "subject"}}Welcome, {{.}} & co{{end}}Hi {{.}} & co`)},
+		"mail/reset.html.tpl":    {Data: []byte(`{{define "subject"}}Reset for {{.}} & co{{end}}<html><head></head><body>Reset {{.}}</body></html>`)},
+		"mail/nosubject.txt.tpl": {Data: []byte(`no subject`)},
+		"mail.css":               {Data: []byte(`p{color:red}`)},
+	}
+	parent := fstest.MapFS{
+		"mail/welcome.html.tpl": {Data: []byte(`{{define "subject"}}Parent{{end}}<p>Hi {{.}}</p>`)},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	m, err := e.RenderEmail("mail/welcome", "Ann <3")
+	if err != nil {
+		t.Fatalf("Failed to render email: %s", err)
+	}
+	if m.Subject != "Welcome, Ann <3 & co" {
+		t.Errorf("Unexpected subject %q", m.Subject)
+	}
+	if m.Text != "Hi Ann <3 & co" {
+		t.Errorf("Unexpected text %q", m.Text)
+	}
+	if m.HTML != "<p>Hi Ann &lt;3</p>" {
+		t.Errorf("Unexpected HTML %q", m.HTML)
+	}
+
+	m.Header.Set("To", "ann@example.com")
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %s", err)
+	}
+	if to := msg.Header.Get("To"); to != "ann@example.com" {
+		t.Errorf("Unexpected To %q", to)
+	}
+	if s := msg.Header.Get("Subject"); s != "Welcome, Ann <3 & co" {
+		t.Errorf("Unexpected Subject %q", s)
+	}
+	typ, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || typ != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative, got %q (%v)", typ, err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for _, expect := range []struct{ typ, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("Failed to read part: %s", err)
+		}
+		body, _ := io.ReadAll(p)
+		if ct := p.Header.Get("Content-Type"); ct != expect.typ {
+			t.Errorf("Expected %s, got %s", expect.typ, ct)
+		}
+		if string(body) != expect.body {
+			t.Errorf("Expected %q, got %q", expect.body, body)
+		}
+	}
+
+	// Only HTML, with a subject from the HTML template and a stylesheet.
+	e.EmailStyle = "mail.css"
+	m, err = e.RenderEmail("mail/reset", "Bob")
+	if err != nil {
+		t.Fatalf("Failed to render email: %s", err)
+	}
+	if m.Subject != "Reset for Bob & co" {
+		t.Errorf("Unexpected subject %q", m.Subject)
+	}
+	if expect := "<html><head><style>\np{color:red}\n</style>\n</head><body>Reset Bob</body></html>"; m.HTML != expect {
+		t.Errorf("Expected %q, got %q", expect, m.HTML)
+	}
+	if m.Text != "" || !strings.Contains(string(m.Bytes()), "Content-Type: text/html") {
+		t.Errorf("Expected an HTML-only message, got %q", m.Bytes())
+	}
+
+	// The subject of another email doesn't leak into one without.
+	if m, err := e.RenderEmail("mail/nosubject", nil); err != nil || m.Subject != "" {
+		t.Errorf("Expected no subject, got %q (%v)", m.Subject, err)
+	}
+
+	if _, err := e.RenderEmail("mail/nope", nil); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+}
@@ -5,10 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/Masterminds/sprig"
 )
@@ -34,13 +39,16 @@ var NamedTemplateSeparator = "#"
 // "foo", but the path "foo/../.." is not okay, as it will evaluate to
 // "..", which represents a potential security risk.
 //
-// Each path is scanned for files that end with the extension '.tpl'.
-// Directories are not scanned recursively. Any other files or directories are
-// ignored.
+// Each path is scanned recursively for files that end with the extension
+// '.tpl' (see SetExtensions). Templates in subdirectories are named by their path relative to
+// the theme directory, so 'themes/default/partials/header.tpl' is rendered
+// as 'partials/header.tpl'. Any other files are ignored.
 //
 // For convenience, the engine supports an additional set of template
 // functions as defined in Sprig:
-// 	https://github.com/Masterminds/sprig
+//
+//	https://github.com/Masterminds/sprig
+//
 // These can be disabled by not passing the Sprig functions into NewEngine.
 func New(paths ...string) (*Engine, error) {
 	return NewEngine(paths, sprig.FuncMap(), []string{})
@@ -52,6 +60,18 @@ func New(paths ...string) (*Engine, error) {
 // - funcMap is passed to the template.
 // - options are passed to the template.
 func NewEngine(paths []string, funcs template.FuncMap, options []string) (*Engine, error) {
+	fsys, err := dirFS(paths)
+	if err != nil {
+		return nil, err
+	}
+	return newEngine(paths, fsys, funcs, options, false)
+}
+
+// dirFS normalizes each of the given paths in place, and returns a file
+// system for each.
+func dirFS(paths []string) ([]fs.FS, error) {
+	fsys := make([]fs.FS, len(paths))
+
 	// First, we do a quick normalization of all paths.
 	for i, d := range paths {
 		d = filepath.Clean(d)
@@ -67,103 +87,565 @@ func NewEngine(paths []string, funcs template.FuncMap, options []string) (*Engin
 			return nil, fmt.Errorf("could not read directory '%s'", d)
 		}
 		paths[i] = d
+		fsys[i] = os.DirFS(d)
 	}
+	return fsys, nil
+}
 
-	e := &Engine{
-		dirs:   paths,
-		cache:  make(map[string]map[string]bool, len(paths)),
-		master: template.New("master"),
+// NewEngineFS constructs a new *Engine whose themes are read from file systems.
+//
+// This behaves like NewEngine, but each theme is an fs.FS instead of a
+// directory. This makes it possible to load themes from an embed.FS, a zip
+// archive, or any other file system implementation. Themes are ordered just
+// as they are in NewEngine: the first theme takes precedence.
+//
+// Since file systems have no names of their own, each theme is named 'fsN',
+// where N is the theme's index in themes. These names are what Dirs returns,
+// and they prefix the paths returned by Paths and Asset.
+func NewEngineFS(themes []fs.FS, funcs template.FuncMap, options []string) (*Engine, error) {
+	return newEngine(fsNames(len(themes)), themes, funcs, options, false)
+}
+
+// NewTextEngine constructs a new *Engine for text that is not HTML.
+//
+// It behaves exactly like NewEngine, except that templates are compiled with
+// text/template instead of html/template, so their output is not escaped.
+// This is suitable for plain text email, configuration files, CSV, and the
+// like.
+//
+// Note that Sprig provides a separate set of functions for text templates:
+//
+//	engine.NewTextEngine(paths, template.FuncMap(sprig.TxtFuncMap()), nil)
+func NewTextEngine(paths []string, funcs template.FuncMap, options []string) (*Engine, error) {
+	fsys, err := dirFS(paths)
+	if err != nil {
+		return nil, err
+	}
+	return newEngine(paths, fsys, funcs, options, true)
+}
+
+// NewTextEngineFS constructs a new *Engine for text that is not HTML, reading
+// themes from file systems.
+//
+// See NewTextEngine and NewEngineFS.
+func NewTextEngineFS(themes []fs.FS, funcs template.FuncMap, options []string) (*Engine, error) {
+	return newEngine(fsNames(len(themes)), themes, funcs, options, true)
+}
+
+// fsNames returns the names given to themes read from file systems.
+func fsNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("fs%d", i)
 	}
+	return names
+}
 
-	if len(funcs) > 0 {
-		e.master.Funcs(funcs)
+// newEngine constructs an *Engine from a list of theme names and their file
+// systems. If text is true, templates are compiled with text/template.
+func newEngine(names []string, fsys []fs.FS, funcs template.FuncMap, options []string, text bool) (*Engine, error) {
+	e := &Engine{
+		AssetPrefix: "/",
+		Cache:       NewLRUCache(DefaultCacheSize),
+		id:          newID(),
+		dirs:        names,
+		fsys:        make(map[string]fs.FS, len(names)),
+		options:     options,
+		text:        text,
+		exts:        []string{".tpl", ".md"},
+		digests:     map[string]*assetDigest{},
+		bundles: bundles{
+			declared: map[string][]string{},
+			built:    map[string]*builtBundle{},
+		},
+	}
+	for i, d := range names {
+		e.fsys[d] = fsys[i]
 	}
-	if len(options) > 0 {
-		e.master.Option(options...)
+
+	// The engine's own functions are available to every template, unless
+	// they are replaced by functions of the same name in funcs.
+	e.funcs = e.builtins()
+	for k, v := range funcs {
+		e.funcs[k] = v
 	}
+	e.ctxFuncs = contextFuncs(e.funcs)
 
-	return e, e.parse()
+	set, err := e.parse(e.dirs, e.fsys, e.exts)
+	if err != nil {
+		return e, err
+	}
+	e.set = set
+	return e, nil
 }
 
 type Engine struct {
+	// hits and misses count RenderCached lookups, and gens counts the
+	// template sets that have been parsed. They are accessed atomically, so
+	// they come first to keep them 64-bit aligned.
+	hits, misses uint64
+	gens         uint64
+
+	// Buffered indicates that RenderTo should render a template completely
+	// before writing anything. If rendering fails, nothing is written. This
+	// is useful when writing to an http.ResponseWriter, where a half-written
+	// page cannot be taken back.
+	Buffered bool
+
+	// AssetPrefix is the URL path at which assets are served, typically by
+	// AssetHandler. It is used by the 'asset' template function to build
+	// URLs, and defaults to "/".
+	AssetPrefix string
+
+	// MinifyBundles indicates that CSS and JavaScript bundles should have
+	// comments and extra whitespace removed. See Bundle.
+	MinifyBundles bool
+
+	// Debug indicates that HTML output should be surrounded by comments
+	// that name the template that produced it, like this:
+	//
+	//	<!-- engine: themes/pretty/main.tpl -->
+	//	...
+	//	<!-- /engine: themes/pretty/main.tpl -->
+	//
+	// The output of each {{template}} call within HTML text is marked the
+	// same way, with the name of the template called. Calls inside tags,
+	// comments, and elements such as <script> are not marked. Text templates
+	// and emails are unaffected. See also Resolve.
+	Debug bool
+
+	// EmailStyle is the name of a stylesheet asset to add to the HTML of
+	// every email rendered by RenderEmail. It is optional.
+	EmailStyle string
+
+	// MarkdownLayout is the name of a layout that Markdown templates are
+	// rendered in. The layout receives the HTML as the template named by
+	// MarkdownBlock. If it is empty, the HTML is rendered on its own.
+	MarkdownLayout string
+
+	// Cache stores the output of RenderCached. It defaults to an LRUCache
+	// of DefaultCacheSize entries.
+	Cache Cache
+
+	// id identifies the engine in keys in Cache. It is random, so that
+	// engines that share a Cache, even across processes, don't collide.
+	id string
+
+	// funcs and options are retained so that templates can be reparsed.
+	funcs   template.FuncMap
+	options []string
+	// ctxFuncs holds the functions in funcs that take a context. See
+	// RenderContext.
+	ctxFuncs map[string]reflect.Value
+	// text indicates that templates are compiled with text/template unless
+	// their names say otherwise.
+	text bool
+
+	// digestsMx guards digests, which caches asset digests by path.
+	digestsMx sync.Mutex
+	digests   map[string]*assetDigest
+
+	bundles bundles
+
+	// updateMx serializes changes to the fields guarded by mx.
+	updateMx sync.Mutex
+
+	// mx guards dirs, fsys, exts, and set. They are replaced wholesale, never
+	// modified, so a copy taken under mx may be used after it is released.
+	// The set is replaced on Reload.
+	mx sync.RWMutex
 	// Order is important, so we keep dirs to maintain an ordering of themes.
 	dirs []string
+	// fsys holds the file system for each theme, keyed by the name in dirs.
+	fsys map[string]fs.FS
+	exts []string
+	set  *templateSet
+}
+
+// templateSet is a complete, parsed collection of templates.
+//
+// Once built, a templateSet is never modified, so it is safe to use
+// concurrently.
+type templateSet struct {
+	// cache maps each theme to the templates it supplies. File templates
+	// are keyed by their relative path, and named templates are keyed by
+	// the path of the defining file, NamedTemplateSeparator, and the name.
+	cache map[string]map[string]bool
+
+	// spaces holds one space for HTML templates and one for text
+	// templates. The space for the engine's default kind comes first.
+	spaces []*space
+	// files maps the name of each file template to its space.
+	files map[string]*space
+
+	// dirs and fsys are the themes that the set was parsed from. See
+	// Engine.dirs.
+	dirs []string
+	fsys map[string]fs.FS
+
+	// themes describes each theme, in the same order as dirs.
+	themes []*Theme
+
+	// sources holds the text of each template file, keyed by its name in
+	// its space. Front matter has been removed.
+	sources map[string]string
+	// meta holds the front matter of each template file that has any.
+	meta map[string]*Meta
+
+	// exts holds the extensions of template files.
+	exts []string
+
+	// gen distinguishes this set from others parsed by the same engine. It
+	// keeps RenderCached from using output from earlier templates.
+	gen uint64
+}
+
+// space holds the templates that are compiled the same way, either with
+// html/template or with text/template.
+type space struct {
+	// text indicates that the templates are not HTML.
+	text   bool
+	master namespace
+	// named maps the name of each named template to the theme whose
+	// definition is in effect.
+	named map[string]string
+
+	// proto is a copy of master that is never executed, and so can be
+	// cloned.
+	proto namespace
+
+	// layouts caches the templates built by RenderWithLayout. It is the
+	// only part of a templateSet that changes after parsing, so it has a
+	// lock of its own.
+	layoutsMx sync.Mutex
+	layouts   map[string]namespace
+
+	// debug indicates that the space is the Debug copy of another, built
+	// by newDebugView. debugView is that copy, built on first use.
+	debug     bool
+	debugOnce sync.Once
+	debugView *space
+	debugErr  error
+}
+
+// builtins returns the template functions that the engine provides.
+func (e *Engine) builtins() template.FuncMap {
+	return template.FuncMap{
+		"asset":    e.assetURL,
+		"assetSRI": e.Integrity,
+	}
+}
+
+// templates returns the current template set.
+func (e *Engine) templates() *templateSet {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	return e.set
+}
+
+// Reload reparses all of the templates in all of the themes.
+//
+// The new templates are swapped in only once they have all been parsed, so
+// calls to Render that are in progress are unaffected. If parsing fails, the
+// error is returned and the previously loaded templates remain in use.
+func (e *Engine) Reload() error {
+	return e.SetExtensions(e.Extensions()...)
+}
 
-	cache  map[string]map[string]bool
-	master *template.Template
+// Extensions returns the extensions of template files.
+func (e *Engine) Extensions() []string {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	return append([]string(nil), e.exts...)
+}
+
+// SetExtensions sets the extensions of template files, and reloads the
+// templates.
+//
+// By default, files ending with '.tpl' or '.md' are templates (see
+// MarkdownLayout for the latter). Any file that
+// ends with one of the given extensions is a template, and can't be fetched
+// as an asset. An extension may contain more than one dot, as in '.html.tpl'.
+//
+// Templates are escaped for HTML unless the engine is a text engine (see
+// NewTextEngine). This can be overridden per file by putting '.txt' or
+// '.html' in front of the template extension: 'mail.txt.tpl' is a text
+// template, and 'mail.html.tpl' is an HTML template, regardless of the kind
+// of engine.
+//
+// Like Reload, if the templates can't be parsed, an error is returned and
+// nothing changes.
+func (e *Engine) SetExtensions(exts ...string) error {
+	norm := make([]string, 0, len(exts))
+	for _, x := range exts {
+		if x == "" || x == "." {
+			return IllegalName
+		}
+		if !strings.HasPrefix(x, ".") {
+			x = "." + x
+		}
+		norm = append(norm, x)
+	}
+
+	e.updateMx.Lock()
+	defer e.updateMx.Unlock()
+
+	e.mx.RLock()
+	dirs, fsys := e.dirs, e.fsys
+	e.mx.RUnlock()
+
+	set, err := e.parse(dirs, fsys, norm)
+	if err != nil {
+		return err
+	}
+	e.mx.Lock()
+	e.exts = norm
+	e.set = set
+	e.mx.Unlock()
+	return nil
 }
 
 // Render looks for a template with the given name, then executes it with the given data.
 //
-// The 'name' parameter should be a relative template name (foo.tpl). This
-// will look through all of the known templates and execute the first match
-// found. Traversal order is the order in which the templates were added.
+// The 'name' parameter should be a relative template name (foo.tpl), which
+// may include subdirectories (partials/foo.tpl). This will look through all
+// of the known templates and execute the first match found. Traversal order
+// is the order in which the templates were added.
+//
+// A name that begins with NamedTemplateSeparator (#header) refers to a
+// template created with 'define' rather than to a file. If more than one
+// theme defines a template with that name, the definition in the first theme
+// is used. This is also the definition that every other template sees when
+// it calls '{{template "header"}}', so a theme can override a named template
+// that is used by another theme's files.
 //
 // The 'data' will be passed into the template unaltered.
 //
 // If the renderer cannot find a template, it returns NoTemplateFound. If
-// the template cannot be rendered, it may return a different error.
+// the template cannot be rendered, it returns a *RenderError.
 func (e *Engine) Render(name string, data interface{}) (string, error) {
 	var buf bytes.Buffer
+	err := e.RenderTo(&buf, name, data)
+	return buf.String(), err
+}
+
+// RenderTo looks for a template with the given name, then executes it with
+// the given data, writing the output to w.
+//
+// Templates are located exactly as they are by Render. Unless the Engine is
+// Buffered, output is written to w as the template executes, so an error
+// part way through can leave partial output in w.
+func (e *Engine) RenderTo(w io.Writer, name string, data interface{}) error {
+	return e.renderTo(w, e.templates(), name, data)
+}
+
+// renderTo is RenderTo with the templates in set.
+func (e *Engine) renderTo(w io.Writer, set *templateSet, name string, data interface{}) error {
+	sp, key, err := e.lookupView(set, name)
+	if err != nil {
+		return err
+	}
+
+	err = e.executePage(w, set, sp, sp.master, key, data, nil)
+	return e.renderError(set, sp, name, key, err)
+}
+
+// execute executes the named template in t, honoring Buffered.
+//
+// If label is not empty, the output is surrounded by HTML comments
+// containing it. See debugLabel.
+func (e *Engine) execute(w io.Writer, t namespace, name string, data interface{}, label string) error {
+	out := w
+	var buf bytes.Buffer
+	if e.Buffered {
+		out = &buf
+	}
+
+	if label != "" {
+		if _, err := fmt.Fprintf(out, "<!-- engine: %s -->", label); err != nil {
+			return err
+		}
+	}
+	if err := t.ExecuteTemplate(out, name, data); err != nil {
+		return err
+	}
+	if label != "" {
+		if _, err := fmt.Fprintf(out, "<!-- /engine: %s -->", label); err != nil {
+			return err
+		}
+	}
 
+	if e.Buffered {
+		_, err := buf.WriteTo(w)
+		return err
+	}
+	return nil
+}
+
+// executePage executes the file template key from the space sp, using the
+// templates in t. If bound is not nil, it holds functions bound to a context
+// (see RenderContext), which t already uses, and which must be used by any
+// layout as well.
+//
+// If the template's front matter names a layout, the template is rendered in
+// that layout. Markdown templates are converted to HTML, which is rendered
+// in that layout or in MarkdownLayout, if either is set.
+func (e *Engine) executePage(w io.Writer, set *templateSet, sp *space, t namespace, key string, data interface{}, bound template.FuncMap) error {
+	layout := ""
+	if m, ok := set.meta[key]; ok {
+		if err := checkRequired(m.Required, data); err != nil {
+			return err
+		}
+		layout = m.Layout
+	}
+
+	if isMarkdown(key) {
+		if layout == "" {
+			layout = e.MarkdownLayout
+		}
+		return e.executeMarkdown(w, set, t, key, layout, data, bound)
+	}
+	if layout == "" {
+		return e.execute(w, t, key, data, e.debugLabel(sp, key))
+	}
+
+	lsp, lkey, err := e.lookupView(set, layout)
+	if err != nil {
+		return err
+	}
+	var lt namespace
+	if bound == nil {
+		lt, err = lsp.layout(key, set.sources[key], e.funcs)
+	} else {
+		// The cached copy can't be rebound, since it may have been
+		// executed already.
+		if lt, err = lsp.newLayout(key, set.sources[key], e.funcs); err == nil {
+			lt.Funcs(bound)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return e.execute(w, lt, lkey, data, e.debugLabel(lsp, key+" in "+lkey))
+}
+
+// debugLabel returns the label that execute should use for output from the
+// space sp, which is label if the engine is in Debug mode and sp produces
+// HTML, and is otherwise empty.
+func (e *Engine) debugLabel(sp *space, label string) string {
+	if !e.Debug || sp.text {
+		return ""
+	}
+	return commentSafe(label)
+}
+
+// lookup returns the space and the name within it of the template that
+// should be executed for name.
+func (e *Engine) lookup(set *templateSet, name string) (*space, string, error) {
 	// Support explicitly named templates (things from a template
-	// define) by accessing them directly.
+	// define). Only names that some theme defines are allowed.
 	if strings.HasPrefix(name, NamedTemplateSeparator) {
-		err := e.master.ExecuteTemplate(&buf, name[1:], data)
-		return buf.String(), err
+		for _, sp := range set.spaces {
+			if _, ok := sp.named[name[1:]]; ok {
+				return sp, name[1:], nil
+			}
+		}
+		return nil, "", NoTemplateFound
 	}
 
 	// File-based templates.
 	n := filepath.Clean(name)
-	for _, d := range e.dirs {
-		if t, ok := e.cache[d][n]; ok && t {
+	for _, d := range set.dirs {
+		if t, ok := set.cache[d][n]; ok && t {
 			key := filepath.Join(d, n)
-			err := e.master.ExecuteTemplate(&buf, key, data)
-			return buf.String(), err
+			return set.files[key], key, nil
 		}
 	}
-	return "", NoTemplateFound
+	return nil, "", NoTemplateFound
 }
 
 // Asset returns the first matching asset path.
 //
-// An asset is a non-template file or directory in a theme directory. This
+// An asset is a non-template file or directory in a theme directory. The
+// theme's manifest and files matching StrayFilePatterns are not assets. This
 // function returns the string path of the first path that matches.
 //
 // An asset path is only returned if the asset exists and can be stat'ed.
+//
+// For themes loaded with NewEngineFS, the returned path is prefixed with the
+// theme's name, and is not a path on the local file system. Use OpenAsset to
+// read an asset regardless of where it is stored.
 func (e *Engine) Asset(name string) (string, error) {
+	d, n, err := e.findAsset(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, filepath.FromSlash(n)), nil
+}
+
+// OpenAsset opens the first matching asset.
+//
+// Assets are located exactly as they are by Asset. The caller is responsible
+// for closing the returned file.
+func (e *Engine) OpenAsset(name string) (fs.File, error) {
+	d, n, err := e.findAsset(name)
+	if err != nil {
+		return nil, err
+	}
+	return e.templates().fsys[d].Open(n)
+}
+
+// isTemplate returns true if name has a template extension.
+//
+// Markdown files are always treated as templates, even if '.md' is not a
+// template extension, so that their source is never served as an asset.
+func (e *Engine) isTemplate(name string) bool {
+	return hasExt(name, e.templates().exts) || path.Ext(name) == ".md"
+}
+
+// findAsset returns the theme and the cleaned, slash-separated name of the
+// first matching asset.
+func (e *Engine) findAsset(name string) (string, string, error) {
 	name = filepath.Clean(name)
 	if !legalName(name) {
-		return "", IllegalName
+		return "", "", IllegalName
 	}
 
-	// XXX: Should we allow .tpl files to be fetched as assets? Probably
+	// XXX: Should we allow templates to be fetched as assets? Probably
 	// not. For now, denying.
-	if filepath.Ext(name) == ".tpl" {
-		return "", IllegalName
+	if e.isTemplate(name) {
+		return "", "", IllegalName
+	}
+	// Nor the manifest, which may hold settings, or stray files, which
+	// may be copies of templates. Export skips them too.
+	if name == ManifestName || isStray(fsName(name)) {
+		return "", "", IllegalName
 	}
 
-	for _, d := range e.dirs {
-		p := filepath.Join(d, name)
-		if _, err := os.Stat(p); err == nil {
-			return p, nil
+	set := e.templates()
+	n := fsName(name)
+	for _, d := range set.dirs {
+		if _, err := fs.Stat(set.fsys[d], n); err == nil {
+			return d, n, nil
 		}
 	}
 
-	return "", NoAssetFound
+	return "", "", NoAssetFound
 }
 
 // Dirs returns a list of directories that this Engine knows about.
 //
 // Directories are presented in their cleaned, but not absolute, form.
 func (e *Engine) Dirs() []string {
-	return e.dirs
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	return append([]string(nil), e.dirs...)
 }
 
 // Paths returns all know template paths.
 func (e *Engine) Paths() []string {
-	res := make([]string, 0, len(e.dirs))
-	for base, tt := range e.cache {
+	var res []string
+	for base, tt := range e.templates().cache {
 		for rel, _ := range tt {
 			res = append(res, filepath.Join(base, rel))
 		}
@@ -190,64 +672,203 @@ func clean(d string) string {
 	return filepath.Clean(d)
 }
 
-func (e *Engine) parse() error {
+// fsName converts a cleaned name into a name suitable for an fs.FS.
+//
+// File systems require slash-separated, unrooted paths, so '/foo/bar' becomes
+// 'foo/bar'.
+func fsName(name string) string {
+	n := strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+	if n == "" {
+		return "."
+	}
+	return n
+}
+
+// parse reads and compiles the templates in every theme into a new templateSet.
+//
+// Files with any of the given extensions are templates.
+func (e *Engine) parse(dirs []string, fsys map[string]fs.FS, exts []string) (*templateSet, error) {
+	htmlSpace := newSpace(newNamespace(false, e.funcs, e.options), false)
+	textSpace := newSpace(newNamespace(true, e.funcs, e.options), true)
+	set := &templateSet{
+		dirs:   dirs,
+		fsys:   fsys,
+		cache:  make(map[string]map[string]bool, len(dirs)),
+		spaces: []*space{htmlSpace, textSpace},
+		files:  map[string]*space{},
+		themes: make([]*Theme, len(dirs)),
+
+		sources: map[string]string{},
+		meta:    map[string]*Meta{},
+		exts:    exts,
+		gen:     atomic.AddUint64(&e.gens, 1),
+	}
+	if e.text {
+		set.spaces[0], set.spaces[1] = textSpace, htmlSpace
+	}
 
-	// XXX: It is assumed that e.dirs have already been normalized and
+	// XXX: It is assumed that dirs have already been normalized and
 	// checked.
-	for _, d := range e.dirs {
+	//
+	// Themes are parsed in reverse order. Named templates all share one
+	// namespace, and a later definition replaces an earlier one, so this
+	// ensures that the first theme's definition is the one that is used,
+	// both by Render and by templates in other themes.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+
+		t, err := readManifest(fsys[d])
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", filepath.Join(d, ManifestName), err)
+		}
+		t.Dir = d
+		if t.Name == "" {
+			t.Name = filepath.Base(d)
+		}
+		set.themes[i] = t
 
-		ts := filepath.Join(d, "*.tpl")
-		files, err := filepath.Glob(ts)
+		files, err := findTemplates(fsys[d], exts)
 		if err != nil {
-			// ErrBadPattern is the only error that
-			// will return. files is nil if the pattern didn't turn up
-			// anything.
-			return err
+			return nil, err
 		}
 
 		// An dir with no templates is totally legit. This directory may
 		// just contain other assets. So we add to the map and continue.
 		if files == nil {
-			e.cache[d] = map[string]bool{}
+			set.cache[d] = map[string]bool{}
 			continue
 		}
 
-		e.cache[d] = make(map[string]bool, len(files))
-		for _, f := range files {
-			// Second half of cache key.
-			r, err := filepath.Rel(d, f)
+		set.cache[d] = make(map[string]bool, len(files))
+		for _, r := range files {
+			// r is the second half of the cache key, and f is the name
+			// of the template in its space.
+			f := filepath.Join(d, filepath.FromSlash(r))
+			rel := filepath.FromSlash(r)
+
+			data, err := fs.ReadFile(fsys[d], r)
 			if err != nil {
-				return err
+				return nil, err
 			}
-
-			// TODO: Reading the file and then casting it to a string
-			// doesn't feel like the right solution. But using ParseFiles
-			// creates its own naming scheme, which doesn't work for us.
-			data, err := ioutil.ReadFile(f)
+			sp := set.spaces[0]
+			if isText, ok := textTemplate(r); ok && isText != e.text {
+				sp = set.spaces[1]
+			}
+			set.files[f] = sp
+
+			// Text templates may well produce documents that start with
+			// "---", such as YAML, so only HTML and Markdown templates
+			// have front matter.
+			src := string(data)
+			if !sp.text || isMarkdown(r) {
+				var meta *Meta
+				if src, meta, err = splitFrontMatter(src); err != nil {
+					return nil, fmt.Errorf("could not read front matter in %s: %s", f, err)
+				}
+				if meta != nil {
+					set.meta[f] = meta
+				}
+			}
+			set.sources[f] = src
+
+			// Each file is parsed on its own so that we know exactly which
+			// named templates it defines. The resulting trees are then
+			// added to the master of every space, so that any template can
+			// call them whatever its kind. Escaping modifies trees, so each
+			// space other than the file's own gets a copy.
+			trees, err := parseTrees(f, src, e.funcs)
 			if err != nil {
-				return err
+				return nil, err
 			}
-
-			// Assumption is that f is exactly the same as filepath.Join(d, r)
-			if newt, err := e.master.New(f).Parse(string(data)); err != nil {
-				return err
-			} else {
-				// TODO: Currently, these entries are unused, since we
-				// access globally defined named templates directly. But
-				// this provides useful debugging information about where
-				// a particular global template is defined.
-				for _, tpl := range newt.Templates() {
-					tname := tpl.Name()
-					// Skip the ones we already know about.
-					if tname == "master" || tname == f {
-						continue
+			for tname, tree := range trees {
+				for _, s := range set.spaces {
+					t := tree
+					if s != sp {
+						t = tree.Copy()
 					}
-					e.cache[d][r+NamedTemplateSeparator+tname] = true
+					if err := s.master.AddParseTree(tname, t); err != nil {
+						return nil, err
+					}
+					// Skip the file itself, which is recorded below.
+					if tname != f {
+						s.named[tname] = d
+					}
+				}
+				if tname != f {
+					set.cache[d][rel+NamedTemplateSeparator+tname] = true
 				}
 			}
 
-			e.cache[d][r] = true
+			set.cache[d][rel] = true
 		}
 	}
-	return nil
+
+	for _, sp := range set.spaces {
+		proto, err := sp.master.Clone()
+		if err != nil {
+			return nil, err
+		}
+		sp.proto = proto
+	}
+	return set, nil
+}
+
+// newSpace creates a space for the templates in master. If text is true, the
+// templates are text templates.
+func newSpace(master namespace, text bool) *space {
+	return &space{
+		text:    text,
+		master:  master,
+		named:   map[string]string{},
+		layouts: map[string]namespace{},
+	}
+}
+
+// textTemplate determines from its name whether a template produces text or
+// HTML. The name of a text template ends with '.txt' and then a template
+// extension (mail.txt.tpl), and the name of an HTML template ends with
+// '.html' and then a template extension (mail.html.tpl). Markdown templates
+// are text templates too. For any other name, ok is false.
+func textTemplate(name string) (text, ok bool) {
+	// Markdown is escaped when it is converted to HTML, not before.
+	if isMarkdown(name) {
+		return true, true
+	}
+	inner := path.Ext(strings.TrimSuffix(name, path.Ext(name)))
+	switch inner {
+	case ".txt":
+		return true, true
+	case ".html", ".htm":
+		return false, true
+	}
+	return false, false
+}
+
+// findTemplates walks the file system and returns the paths of all of the
+// templates found within it or any of its subdirectories.
+//
+// The returned paths are slash-separated and relative to the root of fsys.
+// If no templates are found, the returned slice is nil.
+func findTemplates(fsys fs.FS, exts []string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !de.IsDir() && hasExt(p, exts) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// hasExt returns true if the name ends with one of the extensions.
+func hasExt(name string, exts []string) bool {
+	for _, x := range exts {
+		if strings.HasSuffix(name, x) {
+			return true
+		}
+	}
+	return false
 }
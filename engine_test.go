@@ -1,8 +1,15 @@
 package engine
 
 import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestNoDirs(t *testing.T) {
@@ -89,9 +96,11 @@ func TestRender(t *testing.T) {
 		t.Errorf("Failed parse of testdata: %s", err)
 	}
 
+	// Theme directories are scanned recursively, so the nested testdata
+	// themes are found as well.
 	paths := e.Paths()
-	if len(paths) != 1 {
-		t.Errorf("Expected 1 template. Found %d", len(paths))
+	if len(paths) != 7 {
+		t.Errorf("Expected 7 templates. Found %d", len(paths))
 		for _, p := range paths {
 			println("Template: ", p)
 		}
@@ -135,6 +144,38 @@ func TestCascadingRender(t *testing.T) {
 	}
 }
 
+func TestRecursiveRender(t *testing.T) {
+	e, err := New("testdata/override", "testdata/base")
+	if err != nil {
+		t.Errorf("Failed parse of testdata: %s", err)
+	}
+
+	expect := map[string]string{
+		"partials/header.tpl":   "OVERRIDE HEADER:test",
+		"partials/footer.tpl":   "BASE FOOTER:test",
+		"./partials/footer.tpl": "BASE FOOTER:test",
+	}
+	for name, e2 := range expect {
+		out, err := e.Render(name, "test")
+		if err != nil {
+			t.Errorf("Failed render of %s: %s", name, err)
+		}
+		if out = strings.TrimSpace(out); out != e2 {
+			t.Errorf("Expected %q, got %q", e2, out)
+		}
+	}
+
+	found := false
+	for _, p := range e.Paths() {
+		if p == "testdata/base/partials/footer.tpl" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected nested template in Paths()")
+	}
+}
+
 func TestAsset(t *testing.T) {
 	e, err := New("testdata/override", "testdata/base")
 	if err != nil {
@@ -157,3 +198,314 @@ func TestAsset(t *testing.T) {
 	}
 
 }
+
+func TestNewEngineFS(t *testing.T) {
+	mem := fstest.MapFS{
+		"simple.tpl":         {Data: []byte("MEMORY:{{.}}")},
+		"partials/menu.tpl":  {Data: []byte("menu:{{.}}")},
+		"css/main.css":       {Data: []byte("body{}")},
+		"templates-only.tpl": {Data: []byte("{{.}}")},
+	}
+	e, err := NewEngineFS([]fs.FS{mem, os.DirFS("testdata/base")}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load file systems: %s", err)
+	}
+
+	if d := e.Dirs(); len(d) != 2 || d[0] != "fs0" || d[1] != "fs1" {
+		t.Errorf("Unexpected dirs: %v", d)
+	}
+
+	expect := map[string]string{
+		"simple.tpl":        "MEMORY:test",
+		"partials/menu.tpl": "menu:test",
+		"onlybase.tpl":      "onlybase:test",
+	}
+	for name, e2 := range expect {
+		out, err := e.Render(name, "test")
+		if err != nil {
+			t.Errorf("Failed render of %s: %s", name, err)
+		}
+		if out = strings.TrimSpace(out); out != e2 {
+			t.Errorf("Expected %q, got %q", e2, out)
+		}
+	}
+
+	if a, err := e.Asset("asset.dat"); err != nil || a != "fs1/asset.dat" {
+		t.Errorf("Expected fs1/asset.dat, got %q (%v)", a, err)
+	}
+
+	f, err := e.OpenAsset("/css/main.css")
+	if err != nil {
+		t.Fatalf("Could not open main.css: %s", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "body{}" {
+		t.Errorf("Unexpected asset contents %q", data)
+	}
+
+	if _, err := e.OpenAsset("simple.tpl"); err != IllegalName {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+	if _, err := e.OpenAsset("nope.css"); err != NoAssetFound {
+		t.Errorf("Expected NoAssetFound, got %v", err)
+	}
+}
+
+func TestRenderTo(t *testing.T) {
+	mem := fstest.MapFS{
+		"good.tpl": {Data: []byte("good:{{.}}")},
+		"bad.tpl":  {Data: []byte("before{{fail}}after")},
+	}
+	funcs := template.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("boom") },
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, funcs, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := e.RenderTo(&buf, "good.tpl", "test"); err != nil {
+		t.Errorf("Failed render: %s", err)
+	}
+	if buf.String() != "good:test" {
+		t.Errorf("Expected 'good:test', got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := e.RenderTo(&buf, "nope.tpl", "test"); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+
+	// Unbuffered output is written as the template executes.
+	buf.Reset()
+	if err := e.RenderTo(&buf, "bad.tpl", "test"); err == nil {
+		t.Error("Expected bad.tpl to fail")
+	}
+	if buf.String() != "before" {
+		t.Errorf("Expected partial output, got %q", buf.String())
+	}
+
+	// Buffered output is discarded on failure.
+	e.Buffered = true
+	buf.Reset()
+	if err := e.RenderTo(&buf, "bad.tpl", "test"); err == nil {
+		t.Error("Expected bad.tpl to fail")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output, got %q", buf.String())
+	}
+	if err := e.RenderTo(&buf, "good.tpl", "test"); err != nil || buf.String() != "good:test" {
+		t.Errorf("Expected 'good:test', got %q (%v)", buf.String(), err)
+	}
+}
+
+func TestNamedTemplateCascade(t *testing.T) {
+	child := fstest.MapFS{
+		"header.tpl": {Data: []byte(`{{define "header"}}CHILD HEADER{{end}}`)},
+	}
+	parent := fstest.MapFS{
+		"header.tpl": {Data: []byte(`{{define "header"}}PARENT HEADER{{end}}`)},
+		"footer.tpl": {Data: []byte(`{{define "footer"}}PARENT FOOTER{{end}}`)},
+		"page.tpl":   {Data: []byte(`{{template "header"}}|{{template "footer"}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	expect := map[string]string{
+		"#header":  "CHILD HEADER",
+		"#footer":  "PARENT FOOTER",
+		"page.tpl": "CHILD HEADER|PARENT FOOTER",
+	}
+	for name, e2 := range expect {
+		out, err := e.Render(name, nil)
+		if err != nil {
+			t.Errorf("Failed render of %s: %s", name, err)
+		}
+		if out != e2 {
+			t.Errorf("Expected %q, got %q", e2, out)
+		}
+	}
+
+	if _, err := e.Render("#nope", nil); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+}
+
+func TestTextEngine(t *testing.T) {
+	mem := fstest.MapFS{
+		"email.tpl":  {Data: []byte(`Dear {{.}}, {{template "sig"}}`)},
+		"sig.tpl":    {Data: []byte(`{{define "sig"}}-- <Management>{{end}}`)},
+		"report.csv": {Data: []byte("a,b")},
+	}
+	e, err := NewTextEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	out, err := e.Render("email.tpl", "Tom & Jerry")
+	if err != nil {
+		t.Errorf("Failed render: %s", err)
+	}
+	if expect := "Dear Tom & Jerry, -- <Management>"; out != expect {
+		t.Errorf("Expected %q, got %q", expect, out)
+	}
+
+	out, err = e.RenderWithLayout("sig.tpl", "email.tpl", "<you>")
+	if err != nil {
+		t.Errorf("Failed render: %s", err)
+	}
+	if expect := "Dear <you>, -- <Management>"; out != expect {
+		t.Errorf("Expected %q, got %q", expect, out)
+	}
+
+	if a, err := e.Asset("report.csv"); err != nil || a != "fs0/report.csv" {
+		t.Errorf("Expected fs0/report.csv, got %q (%v)", a, err)
+	}
+
+	// The same templates are escaped by an HTML engine.
+	e, err = NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	out, err = e.Render("email.tpl", "Tom & Jerry")
+	if err != nil {
+		t.Errorf("Failed render: %s", err)
+	}
+	if expect := "Dear Tom &amp; Jerry, -- <Management>"; out != expect {
+		t.Errorf("Expected %q, got %q", expect, out)
+	}
+}
+
+func TestNewTextEngine(t *testing.T) {
+	e, err := NewTextEngine([]string{"testdata/override/", "testdata/base"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed parse of testdata: %s", err)
+	}
+	if d := e.Dirs(); d[0] != "testdata/override" {
+		t.Errorf("Expected a cleaned path, got %q", d[0])
+	}
+	out, err := e.Render("simple.tpl", "<test>")
+	if err != nil {
+		t.Errorf("Failed render: %s", err)
+	}
+	if out = strings.TrimSpace(out); out != "OVERRIDE:<test>" {
+		t.Errorf("Expected 'OVERRIDE:<test>', got %q", out)
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	mem := fstest.MapFS{
+		"page.gohtml":   {Data: []byte(`page:{{.}}`)},
+		"page.tpl":      {Data: []byte(`tpl:{{.}}`)},
+		"mail.txt.tpl":  {Data: []byte(`text:{{.}}`)},
+		"mail.html.tpl": {Data: []byte(`html:{{.}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	if x := e.Extensions(); len(x) != 2 || x[0] != ".tpl" || x[1] != ".md" {
+		t.Errorf("Unexpected default extensions %v", x)
+	}
+	if _, err := e.Asset("page.gohtml"); err != nil {
+		t.Errorf("Expected page.gohtml to be an asset, got %v", err)
+	}
+
+	if err := e.SetExtensions("gohtml", ".tpl"); err != nil {
+		t.Fatalf("Failed to set extensions: %s", err)
+	}
+	if _, err := e.Asset("page.gohtml"); err != IllegalName {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+
+	expect := map[string]string{
+		"page.gohtml":   "page:&lt;b&gt;",
+		"page.tpl":      "tpl:&lt;b&gt;",
+		"mail.txt.tpl":  "text:<b>",
+		"mail.html.tpl": "html:&lt;b&gt;",
+	}
+	for name, e2 := range expect {
+		out, err := e.Render(name, "<b>")
+		if err != nil {
+			t.Errorf("Failed render of %s: %s", name, err)
+		}
+		if out != e2 {
+			t.Errorf("Expected %q, got %q", e2, out)
+		}
+	}
+
+	// In a text engine, only .html templates are escaped.
+	e, err = NewTextEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	expect = map[string]string{
+		"page.tpl":      "tpl:<b>",
+		"mail.txt.tpl":  "text:<b>",
+		"mail.html.tpl": "html:&lt;b&gt;",
+	}
+	for name, e2 := range expect {
+		out, err := e.Render(name, "<b>")
+		if err != nil {
+			t.Errorf("Failed render of %s: %s", name, err)
+		}
+		if out != e2 {
+			t.Errorf("Expected %q, got %q", e2, out)
+		}
+	}
+
+	if err := e.SetExtensions(""); err != IllegalName {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+}
+
+func TestSharedDefines(t *testing.T) {
+	mem := fstest.MapFS{
+		"partials.tpl":  {Data: []byte(`{{define "sig"}}-- {{.}}{{end}}`)},
+		"page.tpl":      {Data: []byte(`page {{template "sig" .}}`)},
+		"mail.txt.tpl":  {Data: []byte(`text {{template "sig" .}}`)},
+		"mail.html.tpl": {Data: []byte(`html {{template "sig" .}}`)},
+	}
+	expect := map[string]string{
+		"page.tpl":      "page -- &lt;b&gt;",
+		"mail.txt.tpl":  "text -- <b>",
+		"mail.html.tpl": "html -- &lt;b&gt;",
+		"#sig":          "-- &lt;b&gt;",
+	}
+	textExpect := map[string]string{
+		"page.tpl":      "page -- <b>",
+		"mail.txt.tpl":  "text -- <b>",
+		"mail.html.tpl": "html -- &lt;b&gt;",
+		"#sig":          "-- <b>",
+	}
+
+	for _, text := range []bool{false, true} {
+		newEngine, x := NewEngineFS, expect
+		if text {
+			newEngine, x = NewTextEngineFS, textExpect
+		}
+		e, err := newEngine([]fs.FS{mem}, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to load templates: %s", err)
+		}
+		// Render twice, since escaping happens on first use.
+		for i := 0; i < 2; i++ {
+			for name, e2 := range x {
+				out, err := e.Render(name, "<b>")
+				if err != nil {
+					t.Errorf("Failed render of %s: %s", name, err)
+				}
+				if out != e2 {
+					t.Errorf("Expected %q, got %q", e2, out)
+				}
+			}
+		}
+	}
+}
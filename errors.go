@@ -0,0 +1,311 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// RenderError describes a failure to execute a template.
+//
+// Errors that occur while a template is executing are returned as a
+// *RenderError, which records where the error happened:
+//
+//	out, err := e.Render("main.tpl", data)
+//	var re *engine.RenderError
+//	if errors.As(err, &re) {
+//		log.Printf("%s line %d", re.Path, re.Line)
+//	}
+type RenderError struct {
+	// Name is the name that was passed to Render.
+	Name string
+	// Theme is the theme that supplied the template for Name.
+	Theme string
+	// Path is the template file in which the error occurred. This is not
+	// necessarily the file for Name, since that template may have called
+	// another.
+	Path string
+	// Line and Column locate the error in Path. They are zero if unknown.
+	Line, Column int
+	// Stack lists the templates that were being executed, starting with
+	// the template for Name and ending with the one in which the error
+	// occurred. It is worked out from the {{template}} calls in each
+	// template.
+	Stack []string
+	// Err is the underlying error.
+	Err error
+
+	// source is the text of Path.
+	source string
+}
+
+func (r *RenderError) Error() string {
+	return fmt.Sprintf("rendering %s (theme %s): %s", r.Name, r.Theme, r.Err)
+}
+
+func (r *RenderError) Unwrap() error {
+	return r.Err
+}
+
+// execErrorRE matches the location at the start of a text/template error.
+var execErrorRE = regexp.MustCompile(`^template: (.*):(\d+):(\d+): executing "(.*?)"`)
+
+// renderError wraps an error from executing the template key in the space sp
+// in a *RenderError. name is the name that was passed to Render.
+func (e *Engine) renderError(set *templateSet, sp *space, name, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var re *RenderError
+	if errors.As(err, &re) {
+		return err
+	}
+
+	re = &RenderError{Name: name, Err: err}
+	if strings.HasPrefix(name, NamedTemplateSeparator) {
+		re.Theme = sp.named[key]
+	} else {
+		re.Theme = e.themeOf(set, key)
+	}
+
+	// The template in which the error happened.
+	var failed string
+
+	var execErr texttemplate.ExecError
+	var escErr *template.Error
+	switch {
+	case errors.As(err, &execErr):
+		failed = execErr.Name
+		if m := execErrorRE.FindStringSubmatch(execErr.Error()); m != nil {
+			// Every template is parsed under the name of its file.
+			re.Path = m[1]
+			re.Line, _ = strconv.Atoi(m[2])
+			re.Column, _ = strconv.Atoi(m[3])
+		}
+	case errors.As(err, &escErr):
+		failed = escErr.Name
+		re.Line = escErr.Line
+		re.Path = e.fileOf(set, sp, failed)
+	default:
+		return re
+	}
+
+	re.source = set.sources[re.Path]
+	re.Stack = callStack(sp.proto, key, failed)
+	return re
+}
+
+// Check finds the HTML templates that can never render, and returns an error
+// for each, sorted by file.
+//
+// html/template only checks that a template is well formed, for instance that
+// it doesn't end inside an attribute, the first time the template executes,
+// so these problems are not found when the themes are loaded. Check executes
+// each file template only until it first writes output, so actions that come
+// before any text may run. The errors are *RenderErrors wrapping
+// *template.Errors.
+func (e *Engine) Check() []error {
+	set := e.templates()
+	keys := make([]string, 0, len(set.files))
+	for key, sp := range set.files {
+		if !sp.text {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		sp := set.files[key]
+		t, err := sp.proto.Clone()
+		if err != nil {
+			return append(errs, err)
+		}
+		// Escaping happens before anything is written, and the first
+		// write stops the execution.
+		err = t.ExecuteTemplate(failWriter{}, key, nil)
+		var escErr *template.Error
+		if errors.As(err, &escErr) {
+			name, _ := filepath.Rel(e.themeOf(set, key), key)
+			errs = append(errs, e.renderError(set, sp, name, key, err))
+		}
+	}
+	return errs
+}
+
+// errStop is returned by failWriter.
+var errStop = errors.New("stop")
+
+// failWriter is an io.Writer that fails every write.
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errStop
+}
+
+// themeOf returns the theme that holds the file template with the given key.
+func (e *Engine) themeOf(set *templateSet, key string) string {
+	for _, d := range set.dirs {
+		if rel, err := filepath.Rel(d, key); err == nil && set.cache[d][rel] {
+			return d
+		}
+	}
+	return ""
+}
+
+// fileOf returns the key of the file that supplies the template with the
+// given name.
+func (e *Engine) fileOf(set *templateSet, sp *space, name string) string {
+	if _, ok := set.sources[name]; ok {
+		return name
+	}
+	d, ok := sp.named[name]
+	if !ok {
+		return ""
+	}
+	for k := range set.cache[d] {
+		if strings.HasSuffix(k, NamedTemplateSeparator+name) {
+			return filepath.Join(d, strings.TrimSuffix(k, NamedTemplateSeparator+name))
+		}
+	}
+	return ""
+}
+
+// callStack finds a chain of {{template}} calls that leads from the template
+// named from to the template named to. If there is none, it returns just
+// those two names.
+func callStack(ns namespace, from, to string) []string {
+	if from == to {
+		return []string{from}
+	}
+
+	// A breadth-first search finds the shortest chain.
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		tree := ns.tree(cur)
+		if tree == nil {
+			continue
+		}
+		for _, next := range templateCalls(tree.Root) {
+			if _, seen := prev[next]; seen {
+				continue
+			}
+			prev[next] = cur
+			if next == to {
+				stack := []string{to}
+				for n := cur; n != ""; n = prev[n] {
+					stack = append([]string{n}, stack...)
+				}
+				return stack
+			}
+			queue = append(queue, next)
+		}
+	}
+	return []string{from, to}
+}
+
+// templateCalls returns the names of the templates called by a node and its
+// children.
+func templateCalls(node parse.Node) []string {
+	var names []string
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			names = append(names, templateCalls(c)...)
+		}
+	case *parse.TemplateNode:
+		names = append(names, n.Name)
+	case *parse.IfNode:
+		names = append(names, templateCalls(n.List)...)
+		names = append(names, templateCalls(n.ElseList)...)
+	case *parse.RangeNode:
+		names = append(names, templateCalls(n.List)...)
+		names = append(names, templateCalls(n.ElseList)...)
+	case *parse.WithNode:
+		names = append(names, templateCalls(n.List)...)
+		names = append(names, templateCalls(n.ElseList)...)
+	}
+	return names
+}
+
+// excerptLines is the number of lines shown on either side of an error.
+const excerptLines = 5
+
+// excerptLine is a line of source shown on an error page.
+type excerptLine struct {
+	Number int
+	Text   string
+	Error  bool
+}
+
+// excerpt returns the lines of source around the error.
+func (r *RenderError) excerpt() []excerptLine {
+	if r.source == "" || r.Line == 0 {
+		return nil
+	}
+	lines := strings.Split(r.source, "\n")
+	start, end := r.Line-excerptLines, r.Line+excerptLines
+	if start < 1 {
+		start = 1
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	res := make([]excerptLine, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		res = append(res, excerptLine{i, lines[i-1], i == r.Line})
+	}
+	return res
+}
+
+// WriteHTML writes a page describing the error, including an excerpt of the
+// template source around the error.
+//
+// The page exposes template source and internal paths, so it is meant for
+// use during development only.
+func (r *RenderError) WriteHTML(w io.Writer) error {
+	return errorPage.Execute(w, map[string]interface{}{
+		"Err":     r,
+		"Excerpt": r.excerpt(),
+	})
+}
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Error rendering {{.Err.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f6f6f6; padding: 1em; overflow: auto; }
+.error { background: #fdd; font-weight: bold; }
+.num { color: #999; display: inline-block; width: 4em; }
+</style>
+</head>
+<body>
+<h1>Error rendering {{.Err.Name}}</h1>
+<p>{{.Err.Err}}</p>
+<dl>
+<dt>Theme</dt><dd>{{.Err.Theme}}</dd>
+{{with .Err.Path}}<dt>File</dt><dd>{{.}}{{with $.Err.Line}}, line {{.}}{{end}}{{with $.Err.Column}}, column {{.}}{{end}}</dd>{{end}}
+{{with .Err.Stack}}<dt>Templates</dt><dd>{{range $i, $n := .}}{{if $i}} &rarr; {{end}}{{$n}}{{end}}</dd>{{end}}
+</dl>
+{{with .Excerpt}}<pre>{{range .}}<span{{if .Error}} class="error"{{end}}><span class="num">{{.Number}}</span>{{.Text}}</span>
+{{end}}</pre>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderError(t *testing.T) {
+	child := fstest.MapFS{
+		"header.tpl": {Data: []byte(`{{define "header"}}<h1>{{template "menu" .}}</h1>{{end}}`)},
+	}
+	parent := fstest.MapFS{
+		"page.tpl": {Data: []byte("<body>\n{{template \"header\" .}}\n</body>")},
+		"menu.tpl": {Data: []byte("{{define \"menu\"}}\n<ul>\n  <li>{{.Missing}}</li>\n</ul>\n{{end}}")},
+		"bad.tpl":  {Data: []byte("<a href='{{.}}")},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	_, err = e.Render("page.tpl", 42)
+	var re *RenderError
+	if !errors.As(err, &re) {
+		t.Fatalf("Expected a *RenderError, got %T: %v", err, err)
+	}
+	if re.Name != "page.tpl" || re.Theme != "fs1" {
+		t.Errorf("Unexpected name or theme: %q %q", re.Name, re.Theme)
+	}
+	if re.Path != "fs1/menu.tpl" || re.Line != 3 || re.Column != 8 {
+		t.Errorf("Unexpected location %s:%d:%d", re.Path, re.Line, re.Column)
+	}
+	if expect := []string{"fs1/page.tpl", "header", "menu"}; !reflect.DeepEqual(re.Stack, expect) {
+		t.Errorf("Expected stack %v, got %v", expect, re.Stack)
+	}
+	if re.Unwrap() == nil || !strings.Contains(re.Error(), "page.tpl") {
+		t.Errorf("Unexpected error %q", re)
+	}
+
+	var buf bytes.Buffer
+	if err := re.WriteHTML(&buf); err != nil {
+		t.Fatalf("Failed to write error page: %s", err)
+	}
+	page := buf.String()
+	for _, s := range []string{
+		"Error rendering page.tpl",
+		"fs1/menu.tpl, line 3, column 8",
+		`<span class="error"><span class="num">3</span>  &lt;li&gt;{{.Missing}}&lt;/li&gt;</span>`,
+		"fs1/page.tpl &rarr; header &rarr; menu",
+	} {
+		if !strings.Contains(page, s) {
+			t.Errorf("Expected error page to contain %q:\n%s", s, page)
+		}
+	}
+
+	_, err = e.Render("#header", 42)
+	if !errors.As(err, &re) || re.Theme != "fs0" || re.Path != "fs1/menu.tpl" {
+		t.Errorf("Unexpected error %#v", err)
+	}
+
+	// Escaping errors are reported too.
+	_, err = e.Render("bad.tpl", 42)
+	if !errors.As(err, &re) || re.Path != "fs1/bad.tpl" {
+		t.Errorf("Unexpected error %#v", err)
+	}
+
+	if _, err := e.Render("nope.tpl", nil); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	mem := fstest.MapFS{
+		"ok.tpl":        {Data: []byte(`<p>{{.Missing.Field}}</p>`)},
+		"attr.tpl":      {Data: []byte(`<a href="{{.}}`)},
+		"branch.tpl":    {Data: []byte(`{{if .}}<b>{{else}}<i{{end}}`)},
+		"calls.tpl":     {Data: []byte(`<p>{{template "open"}}</p>`)},
+		"names.tpl":     {Data: []byte(`{{define "open"}}<a title="{{end}}`)},
+		"plain.txt.tpl": {Data: []byte(`<a href="{{.}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	errs := e.Check()
+	var paths []string
+	for _, err := range errs {
+		var re *RenderError
+		if !errors.As(err, &re) {
+			t.Fatalf("Expected a *RenderError, got %v", err)
+		}
+		paths = append(paths, re.Path)
+	}
+	expect := []string{"fs0/attr.tpl", "fs0/branch.tpl", "fs0/calls.tpl"}
+	if !reflect.DeepEqual(paths, expect) {
+		t.Errorf("Expected errors for %v, got %v", expect, errs)
+	}
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RenderSpec describes how to render a page. It is used by Export.
+type RenderSpec struct {
+	// Template is the name of the template to render.
+	Template string `json:"template"`
+	// Layout is the name of a layout to render the template in, as with
+	// RenderWithLayout. It is optional.
+	Layout string `json:"layout"`
+	// Data is passed to the template.
+	Data interface{} `json:"data"`
+}
+
+// ExportSummary reports what Export wrote.
+type ExportSummary struct {
+	// Pages and Assets are the files that were written, relative to the
+	// output directory.
+	Pages  []string
+	Assets []string
+	// Bytes is the total size of the files.
+	Bytes int64
+}
+
+// Export writes a static copy of a site to the directory outDir.
+//
+// Each route is a URL path, which is rendered according to its RenderSpec.
+// Routes that end in a slash or have no extension are written to an
+// index.html file in the directory for the route, so "/docs/" and "/docs"
+// both become docs/index.html. Other routes are written to the file they
+// name.
+//
+// Every asset supplied by the themes is copied as well, along with every
+// bundle. Only the copy that the engine would serve is written. Assets are
+// written under the path of AssetPrefix, both under their own name and
+// their fingerprinted name, so that the URLs returned by the asset function
+// work. Templates, theme manifests, and files matching StrayFilePatterns are
+// not copied.
+//
+// Export stops at the first error.
+func (e *Engine) Export(outDir string, routes map[string]RenderSpec) (*ExportSummary, error) {
+	sum := &ExportSummary{}
+
+	paths := make([]string, 0, len(routes))
+	for r := range routes {
+		paths = append(paths, r)
+	}
+	sort.Strings(paths)
+	for _, r := range paths {
+		name := routeFile(r)
+		n, err := e.exportPage(filepath.Join(outDir, filepath.FromSlash(name)), routes[r])
+		if err != nil {
+			return sum, fmt.Errorf("exporting %s: %w", r, err)
+		}
+		sum.Pages = append(sum.Pages, name)
+		sum.Bytes += n
+	}
+
+	prefix := "/"
+	if u, err := url.Parse(e.AssetPrefix); err == nil {
+		prefix = u.Path
+	}
+	names, err := e.assetNames()
+	if err != nil {
+		return sum, err
+	}
+	for _, a := range names {
+		data, err := e.assetData(a)
+		if err != nil {
+			return sum, fmt.Errorf("exporting %s: %w", a, err)
+		}
+		fp, err := e.Fingerprint(a)
+		if err != nil {
+			return sum, fmt.Errorf("exporting %s: %w", a, err)
+		}
+		for _, n := range []string{a, fp} {
+			name := strings.TrimPrefix(path.Join(prefix, n), "/")
+			if err := writeAsset(filepath.Join(outDir, filepath.FromSlash(name)), data); err != nil {
+				return sum, err
+			}
+			sum.Assets = append(sum.Assets, name)
+			sum.Bytes += int64(len(data))
+		}
+	}
+	return sum, nil
+}
+
+// routeFile returns the file, relative to the output directory, that a route
+// is written to.
+func routeFile(route string) string {
+	p := path.Clean("/" + route)
+	if strings.HasSuffix(route, "/") || path.Ext(p) == "" {
+		p = path.Join(p, "index.html")
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// exportPage renders a page to the file name, returning its size.
+func (e *Engine) exportPage(name string, spec RenderSpec) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	w := &countingWriter{w: bw}
+	if spec.Layout != "" {
+		err = e.RenderWithLayoutTo(w, spec.Template, spec.Layout, spec.Data)
+	} else {
+		err = e.RenderTo(w, spec.Template, spec.Data)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return w.n, f.Close()
+}
+
+// assetNames returns the names of every asset and bundle, in order.
+func (e *Engine) assetNames() ([]string, error) {
+	set := e.templates()
+	names := map[string]bool{}
+	for _, d := range set.dirs {
+		err := fs.WalkDir(set.fsys[d], ".", func(p string, de fs.DirEntry, err error) error {
+			if err != nil || de.IsDir() || p == ManifestName || e.isTemplate(p) || isStray(p) {
+				return err
+			}
+			names[p] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e.bundles.mx.Lock()
+	for n := range e.bundles.declared {
+		names[n] = true
+	}
+	e.bundles.mx.Unlock()
+	for _, t := range e.Themes() {
+		for n := range t.Bundles {
+			names[n] = true
+		}
+	}
+	return sortedKeys(names), nil
+}
+
+// assetData returns the contents of an asset or bundle.
+func (e *Engine) assetData(name string) ([]byte, error) {
+	b, err := e.bundle(name)
+	if err != nil {
+		return nil, err
+	} else if b != nil {
+		return b.data, nil
+	}
+
+	f, err := e.OpenAsset(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// isStray returns true if the file p matches one of StrayFilePatterns.
+func isStray(p string) bool {
+	for _, pat := range StrayFilePatterns {
+		if ok, _ := path.Match(pat, path.Base(p)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAsset writes an exported asset to the file name.
+func writeAsset(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0644)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
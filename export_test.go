@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExport(t *testing.T) {
+	child := fstest.MapFS{
+		"page.tpl":     {Data: []byte(`<link href="{{asset "css/site.css"}}">{{.}}`)},
+		"doc.tpl":      {Data: []byte(`{{define "content"}}doc:{{.}}{{end}}`)},
+		"css/site.css": {Data: []byte(`child`)},
+		"page.tpl~":    {Data: []byte(`backup`)},
+		"theme.json":   {Data: []byte(`{"bundles": {"all.css": ["css/site.css", "base.css"]}}`)},
+	}
+	parent := fstest.MapFS{
+		"layout.tpl":   {Data: []byte(`<main>{{block "content" .}}{{end}}</main>`)},
+		"css/site.css": {Data: []byte(`parent`)},
+		"base.css":     {Data: []byte(`base`)},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	e.AssetPrefix = "/static/"
+
+	out := t.TempDir()
+	sum, err := e.Export(out, map[string]RenderSpec{
+		"/":          {Template: "page.tpl", Data: "home"},
+		"/docs/":     {Template: "doc.tpl", Layout: "layout.tpl", Data: "intro"},
+		"/about.htm": {Template: "page.tpl", Data: "about"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to export: %s", err)
+	}
+
+	site, _ := e.Fingerprint("css/site.css")
+	all, _ := e.Fingerprint("all.css")
+	base, _ := e.Fingerprint("base.css")
+	expect := map[string]string{
+		"index.html":          `<link href="/static/` + site + `">home`,
+		"about.htm":           `<link href="/static/` + site + `">about`,
+		"docs/index.html":     `<main>doc:intro</main>`,
+		"static/css/site.css": "child",
+		"static/" + site:      "child",
+		"static/base.css":     "base",
+		"static/" + base:      "base",
+		"static/all.css":      "child\nbase\n",
+		"static/" + all:       "child\nbase\n",
+	}
+	var size int64
+	for name, data := range expect {
+		b, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Failed to read %s: %s", name, err)
+		} else if string(b) != data {
+			t.Errorf("Expected %s to be %q, got %q", name, data, b)
+		}
+		size += int64(len(data))
+	}
+
+	if expect := []string{"index.html", "about.htm", "docs/index.html"}; !reflect.DeepEqual(sum.Pages, expect) {
+		t.Errorf("Expected pages %v, got %v", expect, sum.Pages)
+	}
+	if len(sum.Assets) != 6 {
+		t.Errorf("Expected 6 assets, got %v", sum.Assets)
+	}
+	if sum.Bytes != size {
+		t.Errorf("Expected %d bytes, got %d", size, sum.Bytes)
+	}
+	for _, name := range []string{"static/page.tpl~", "static/theme.json", "static/page.tpl"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err == nil {
+			t.Errorf("Expected %s not to be exported", name)
+		}
+	}
+
+	if _, err := e.Export(t.TempDir(), map[string]RenderSpec{"/": {Template: "nope.tpl"}}); err == nil {
+		t.Error("Expected a missing template to fail")
+	}
+}
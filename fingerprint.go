@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fingerprintLen is the number of bytes of an asset's digest that are used
+// in its fingerprint.
+const fingerprintLen = 4
+
+// assetDigest records the digest of an asset's contents.
+type assetDigest struct {
+	mod  time.Time
+	size int64
+	sum  []byte
+}
+
+// fingerprint returns the hex-encoded fingerprint of the asset.
+func (a *assetDigest) fingerprint() string {
+	return hex.EncodeToString(a.sum[:fingerprintLen])
+}
+
+// Fingerprint returns the name of an asset with a fingerprint of its contents
+// added, so 'css/main.css' becomes something like 'css/main.3f9a1c2d.css'.
+//
+// The fingerprint changes whenever the contents of the asset do, so the
+// fingerprinted name can be cached indefinitely. AssetHandler understands
+// fingerprinted names. The asset is located just as it is by Asset.
+func (e *Engine) Fingerprint(name string) (string, error) {
+	dg, err := e.digest(name)
+	if err != nil {
+		return "", err
+	}
+	n := fsName(filepath.Clean(name))
+	ext := path.Ext(n)
+	return strings.TrimSuffix(n, ext) + "." + dg.fingerprint() + ext, nil
+}
+
+// Integrity returns a Subresource Integrity digest of an asset, suitable for
+// the integrity attribute of a script or link tag:
+//
+//	sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC
+//
+// The asset is located just as it is by Asset. Digests are cached, and are
+// recomputed when the asset changes.
+func (e *Engine) Integrity(name string) (string, error) {
+	dg, err := e.digest(name)
+	if err != nil {
+		return "", err
+	}
+	return "sha384-" + base64.StdEncoding.EncodeToString(dg.sum), nil
+}
+
+// assetURL implements the 'asset' template function:
+//
+//	<link rel="stylesheet" href="{{asset "css/main.css"}}">
+//
+// It returns the fingerprinted URL of the asset, under AssetPrefix.
+func (e *Engine) assetURL(name string) (string, error) {
+	fp, err := e.Fingerprint(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(e.AssetPrefix, "/") + "/" + fp, nil
+}
+
+// digest returns the digest of the named bundle, or of the first matching
+// asset.
+//
+// Digests are cached, and are recomputed when the asset's size or
+// modification time changes.
+func (e *Engine) digest(name string) (*assetDigest, error) {
+	if b, err := e.bundle(name); err != nil {
+		return nil, err
+	} else if b != nil {
+		return b.digest, nil
+	}
+	return e.fileDigest(name)
+}
+
+// fileDigest returns the digest of the named asset, which must be a file and
+// not a bundle.
+func (e *Engine) fileDigest(name string) (*assetDigest, error) {
+	d, n, err := e.findAsset(name)
+	if err != nil {
+		return nil, err
+	}
+	fsys := e.templates().fsys[d]
+	fi, err := fs.Stat(fsys, n)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, NoAssetFound
+	}
+
+	key := path.Join(d, n)
+	e.digestsMx.Lock()
+	dg, ok := e.digests[key]
+	e.digestsMx.Unlock()
+	if ok && dg.mod.Equal(fi.ModTime()) && dg.size == fi.Size() {
+		return dg, nil
+	}
+
+	data, err := fs.ReadFile(fsys, n)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha512.Sum384(data)
+	dg = &assetDigest{mod: fi.ModTime(), size: fi.Size(), sum: sum[:]}
+
+	e.digestsMx.Lock()
+	e.digests[key] = dg
+	e.digestsMx.Unlock()
+	return dg, nil
+}
+
+// unfingerprint removes the fingerprint from a name, returning the original
+// name and the fingerprint. If the name has no fingerprint, ok is false.
+func unfingerprint(name string) (orig, fp string, ok bool) {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if fp := strings.TrimPrefix(path.Ext(stem), "."); isFingerprint(fp) {
+		return strings.TrimSuffix(stem, "."+fp) + ext, fp, true
+	}
+	// Assets without an extension have the fingerprint as their extension.
+	if fp := strings.TrimPrefix(ext, "."); isFingerprint(fp) {
+		return stem, fp, true
+	}
+	return name, "", false
+}
+
+func isFingerprint(s string) bool {
+	if len(s) != 2*fingerprintLen {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"io/fs"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFingerprint(t *testing.T) {
+	mem := fstest.MapFS{
+		"css/main.css": {Data: []byte("body{color:pink}")},
+		"LICENSE":      {Data: []byte("MIT")},
+		"page.tpl":     {Data: []byte(`<link href="{{asset "css/main.css"}}">`)},
+		"missing.tpl":  {Data: []byte(`{{asset "nope.css"}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	fp, err := e.Fingerprint("/css/main.css")
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %s", err)
+	}
+	if !regexp.MustCompile(`^css/main\.[0-9a-f]{8}\.css$`).MatchString(fp) {
+		t.Errorf("Unexpected fingerprinted name %q", fp)
+	}
+	if fp2, _ := e.Fingerprint("css/main.css"); fp2 != fp {
+		t.Errorf("Expected a stable fingerprint, got %q and %q", fp, fp2)
+	}
+	lic, err := e.Fingerprint("LICENSE")
+	if err != nil || !regexp.MustCompile(`^LICENSE\.[0-9a-f]{8}$`).MatchString(lic) {
+		t.Errorf("Unexpected fingerprinted name %q (%v)", lic, err)
+	}
+
+	if _, err := e.Fingerprint("nope.css"); err != NoAssetFound {
+		t.Errorf("Expected NoAssetFound, got %v", err)
+	}
+	if _, err := e.Fingerprint("css"); err != NoAssetFound {
+		t.Errorf("Expected NoAssetFound for a directory, got %v", err)
+	}
+
+	e.AssetPrefix = "/static/"
+	out, err := e.Render("page.tpl", nil)
+	if err != nil {
+		t.Errorf("Failed render: %s", err)
+	}
+	if expect := `<link href="/static/` + fp + `">`; out != expect {
+		t.Errorf("Expected %q, got %q", expect, out)
+	}
+	if _, err := e.Render("missing.tpl", nil); err == nil {
+		t.Error("Expected a missing asset to fail")
+	}
+
+	h := e.AssetHandler("/static/")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/static/"+fp, nil))
+	if res.Code != 200 || res.Body.String() != "body{color:pink}" {
+		t.Errorf("Unexpected response %d %q", res.Code, res.Body.String())
+	}
+	if cc := res.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Errorf("Unexpected Cache-Control %q", cc)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/static/css/main.css", nil))
+	if res.Code != 200 || res.Header().Get("Cache-Control") != "" {
+		t.Errorf("Unexpected response %d %v", res.Code, res.Header())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/static/css/main.00000000.css", nil))
+	if res.Code != 404 {
+		t.Errorf("Expected a stale fingerprint to 404, got %d", res.Code)
+	}
+}
+
+func TestUnfingerprint(t *testing.T) {
+	data := []struct {
+		in, orig, fp string
+		ok           bool
+	}{
+		{"main.3f9a1c2d.css", "main.css", "3f9a1c2d", true},
+		{"css/main.3f9a1c2d.css", "css/main.css", "3f9a1c2d", true},
+		{"LICENSE.3f9a1c2d", "LICENSE", "3f9a1c2d", true},
+		{"main.css", "main.css", "", false},
+		{"main.3f9a1c.css", "main.3f9a1c.css", "", false},
+		{"main.zzzzzzzz.css", "main.zzzzzzzz.css", "", false},
+	}
+	for _, d := range data {
+		orig, fp, ok := unfingerprint(d.in)
+		if orig != d.orig || fp != d.fp || ok != d.ok {
+			t.Errorf("Expected %q, %q, %v for %s; got %q, %q, %v", d.orig, d.fp, d.ok, d.in, orig, fp, ok)
+		}
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.js"), "alert('hi')")
+	writeFile(t, filepath.Join(dir, "page.tpl"), `<script src="{{asset "app.js"}}" integrity="{{assetSRI "app.js"}}"></script>`)
+	e, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	// Computed with: printf "alert('hi')" | openssl dgst -sha384 -binary | base64
+	expect := "sha384-pkiGrqohYBfZ7sU8ryUF95tftmZPtmw2Uaz8EO/sHrYMwUO4YFyF2AXTqs/ziYdP"
+	sri, err := e.Integrity("app.js")
+	if err != nil {
+		t.Fatalf("Failed to compute integrity: %s", err)
+	}
+	if sri != expect {
+		t.Errorf("Expected %q, got %q", expect, sri)
+	}
+
+	out, err := e.Render("page.tpl", nil)
+	if err != nil {
+		t.Errorf("Failed render: %s", err)
+	}
+	if !strings.Contains(out, `integrity="`+expect+`"`) {
+		t.Errorf("Expected integrity attribute in %q", out)
+	}
+
+	// Changing the file changes the digest.
+	writeFile(t, filepath.Join(dir, "app.js"), "alert('bye')")
+	if sri2, err := e.Integrity("app.js"); err != nil || sri2 == sri {
+		t.Errorf("Expected a new digest, got %q (%v)", sri2, err)
+	}
+
+	if _, err := e.Integrity("page.tpl"); err != IllegalName {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// MissingData indicates that data required by a template's front matter was
+// not supplied.
+var MissingData = errors.New("missing required data")
+
+// Meta is the metadata supplied by a template's front matter.
+//
+// Front matter is an optional block at the very start of a template, written
+// in YAML between lines of "---", or in TOML between lines of "+++":
+//
+//	---
+//	title: About us
+//	layout: layouts/main.tpl
+//	content-type: text/html; charset=utf-8
+//	cache: 10m
+//	required: [Name]
+//	---
+//	{{define "content"}}Hello, {{.Name}}!{{end}}
+//
+// The front matter is removed before the template is parsed, but line
+// numbers in errors still refer to the original file.
+//
+// Only HTML and Markdown templates have front matter. Text templates are
+// left alone, since they may produce documents that start the same way, like
+// YAML. A block that isn't valid YAML or TOML isn't front matter either, and
+// is left in the template.
+type Meta struct {
+	// Title is the template's title.
+	Title string
+	// Layout names a layout that Render renders the template in, as if by
+	// RenderWithLayout. It applies when the template is rendered by name,
+	// and not when it is called by another template.
+	Layout string
+	// ContentType is the media type of the template's output. It is used by
+	// ServeTemplate.
+	ContentType string
+	// Cache is how long the output may be cached. It is written as a
+	// duration, like "10m", or a number of seconds. It is used by
+	// ServeTemplate.
+	Cache time.Duration
+	// Required lists keys that must be present in the data passed to the
+	// template, if that data is a map or a struct.
+	Required []string
+	// Params holds every key in the front matter, including those above.
+	Params map[string]interface{}
+}
+
+// Meta returns the metadata from the front matter of the template with the
+// given name. Templates without front matter, including named templates,
+// have empty metadata.
+func (e *Engine) Meta(name string) (*Meta, error) {
+	set := e.templates()
+	_, key, err := e.lookup(set, name)
+	if err != nil {
+		return nil, err
+	}
+	m := &Meta{}
+	if mm, ok := set.meta[key]; ok {
+		*m = *mm
+	}
+	return m, nil
+}
+
+// frontMatterDelims maps the delimiters of front matter to its format.
+var frontMatterDelims = map[string]string{
+	"---": "yaml",
+	"+++": "toml",
+}
+
+// splitFrontMatter removes the front matter from src and parses it. If there
+// is no front matter, src is returned unchanged, and the returned Meta is nil.
+// An error is returned only if the front matter parses, but its keys have
+// the wrong types.
+//
+// The front matter is replaced by a comment of as many lines, so that line
+// numbers are unchanged.
+func splitFrontMatter(src string) (string, *Meta, error) {
+	first := src
+	if i := strings.IndexByte(src, '\n'); i >= 0 {
+		first = src[:i]
+	}
+	delim := strings.TrimSuffix(first, "\r")
+	format, ok := frontMatterDelims[delim]
+	if !ok || len(first) == len(src) {
+		return src, nil, nil
+	}
+
+	// Find the closing delimiter on a line of its own.
+	rest := src[len(first)+1:]
+	var body string
+	var block string
+	for i := 0; ; {
+		end := strings.IndexByte(rest[i:], '\n')
+		line := rest[i:]
+		if end >= 0 {
+			line = rest[i : i+end]
+		}
+		if strings.TrimSuffix(line, "\r") == delim {
+			block = rest[:i]
+			if end >= 0 {
+				body = rest[i+end+1:]
+			}
+			break
+		}
+		if end < 0 {
+			// Without a closing delimiter, it isn't front matter.
+			return src, nil, nil
+		}
+		i += end + 1
+	}
+
+	params := map[string]interface{}{}
+	switch format {
+	case "yaml":
+		if err := yaml.Unmarshal([]byte(block), &params); err != nil {
+			return src, nil, nil
+		}
+	case "toml":
+		if _, err := toml.Decode(block, &params); err != nil {
+			return src, nil, nil
+		}
+	}
+
+	m, err := newMeta(params)
+	if err != nil {
+		return "", nil, err
+	}
+	lines := strings.Count(src[:len(src)-len(body)], "\n")
+	return "{{/*" + strings.Repeat("\n", lines) + "*/}}" + body, m, nil
+}
+
+// newMeta creates a Meta from the keys in front matter.
+func newMeta(params map[string]interface{}) (*Meta, error) {
+	m := &Meta{Params: params}
+	var ok bool
+	if v, has := params["title"]; has {
+		if m.Title, ok = v.(string); !ok {
+			return nil, fmt.Errorf("title must be a string")
+		}
+	}
+	if v, has := params["layout"]; has {
+		if m.Layout, ok = v.(string); !ok {
+			return nil, fmt.Errorf("layout must be a string")
+		}
+	}
+	if v, has := params["content-type"]; has {
+		if m.ContentType, ok = v.(string); !ok {
+			return nil, fmt.Errorf("content-type must be a string")
+		}
+	}
+	if v, has := params["cache"]; has {
+		switch v := v.(type) {
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("cache: %s", err)
+			}
+			m.Cache = d
+		case int:
+			m.Cache = time.Duration(v) * time.Second
+		case int64:
+			m.Cache = time.Duration(v) * time.Second
+		default:
+			return nil, fmt.Errorf("cache must be a duration or a number of seconds")
+		}
+	}
+	if v, has := params["required"]; has {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("required must be a list")
+		}
+		for _, k := range list {
+			s, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("required must be a list of strings")
+			}
+			m.Required = append(m.Required, s)
+		}
+	}
+	return m, nil
+}
+
+// checkRequired returns an error wrapping MissingData if data is a map or
+// struct that lacks any of the required keys.
+func checkRequired(required []string, data interface{}) error {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	var missing []string
+	for _, k := range required {
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil
+			}
+			if !v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())).IsValid() {
+				missing = append(missing, k)
+			}
+		case reflect.Struct:
+			if !v.FieldByName(k).IsValid() {
+				missing = append(missing, k)
+			}
+		default:
+			return nil
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", MissingData, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"errors"
+	"io/fs"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFrontMatter(t *testing.T) {
+	mem := fstest.MapFS{
+		"about.tpl":     {Data: []byte("---\ntitle: About\nlayout: layout.tpl\ncache: 10m\nrequired: [Name]\nextra: {a: 1}\n---\n{{define \"content\"}}Hi {{.Name}}{{end}}")},
+		"feed.tpl":      {Data: []byte("+++\ntitle = \"Feed\"\ncontent-type = \"application/atom+xml\"\ncache = 60\n+++\n<feed>{{.}}</feed>")},
+		"plain.tpl":     {Data: []byte("---\nnot front matter")},
+		"broken.tpl":    {Data: []byte("---\ntitle: x\n---\n\n{{.Nope.Nope}}")},
+		"notes.txt.tpl": {Data: []byte("notes")},
+		"layout.tpl":    {Data: []byte(`<main>{{block "content" .}}{{end}}</main>`)},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	m, err := e.Meta("about.tpl")
+	if err != nil {
+		t.Fatalf("Failed to get meta: %s", err)
+	}
+	if m.Title != "About" || m.Layout != "layout.tpl" || m.Cache != 10*time.Minute || !reflect.DeepEqual(m.Required, []string{"Name"}) {
+		t.Errorf("Unexpected meta %+v", m)
+	}
+	if x, ok := m.Params["extra"].(map[string]interface{}); !ok || x["a"] != 1 {
+		t.Errorf("Unexpected params %v", m.Params)
+	}
+	m, err = e.Meta("feed.tpl")
+	if err != nil || m.Title != "Feed" || m.ContentType != "application/atom+xml" || m.Cache != time.Minute {
+		t.Errorf("Unexpected meta %+v (%v)", m, err)
+	}
+	if m, err := e.Meta("plain.tpl"); err != nil || m.Title != "" {
+		t.Errorf("Expected no meta, got %+v (%v)", m, err)
+	}
+	if _, err := e.Meta("nope.tpl"); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+
+	out, err := e.Render("about.tpl", map[string]string{"Name": "Ann"})
+	if err != nil || out != "<main>Hi Ann</main>" {
+		t.Errorf("Expected the layout to be used, got %q (%v)", out, err)
+	}
+	if _, err := e.Render("about.tpl", map[string]string{}); !errors.Is(err, MissingData) {
+		t.Errorf("Expected MissingData, got %v", err)
+	}
+	if _, err := e.Render("about.tpl", struct{ Name string }{"Ann"}); err != nil {
+		t.Errorf("Expected a struct with the field to be accepted, got %v", err)
+	}
+	expectRender(t, e, "plain.tpl", "---\nnot front matter")
+
+	// Line numbers refer to the file as written.
+	var re *RenderError
+	if _, err := e.Render("broken.tpl", 1); !errors.As(err, &re) || re.Line != 5 {
+		t.Errorf("Expected an error on line 5, got %v", err)
+	}
+
+	res := httptest.NewRecorder()
+	if err := e.ServeTemplate(res, "feed.tpl", "x"); err != nil {
+		t.Fatalf("Failed to serve: %s", err)
+	}
+	if ct := res.Header().Get("Content-Type"); ct != "application/atom+xml" {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	if cc := res.Header().Get("Cache-Control"); cc != "max-age=60" {
+		t.Errorf("Unexpected Cache-Control %q", cc)
+	}
+	if res.Body.String() != "<feed>x</feed>" {
+		t.Errorf("Unexpected body %q", res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	if err := e.ServeTemplate(res, "notes.txt.tpl", nil); err != nil || res.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Expected text/plain, got %q (%v)", res.Header().Get("Content-Type"), err)
+	}
+	res = httptest.NewRecorder()
+	if err := e.ServeTemplate(res, "about.tpl", map[string]string{}); err == nil || res.Body.Len() != 0 {
+		t.Errorf("Expected an error and no output, got %q (%v)", res.Body.String(), err)
+	}
+
+	bad := fstest.MapFS{"bad.tpl": {Data: []byte("---\ncache: soon\n---\n")}}
+	if _, err := NewEngineFS([]fs.FS{bad}, nil, nil); err == nil {
+		t.Error("Expected a bad cache time to fail")
+	}
+}
+
+func TestFrontMatterIgnored(t *testing.T) {
+	yamlDocs := "---\nname: {{.}}\n---\nname: two\n"
+	mem := fstest.MapFS{
+		"cfg.yaml.tpl":  {Data: []byte(yamlDocs)},
+		"cfg.txt.tpl":   {Data: []byte(yamlDocs)},
+		"invalid.tpl":   {Data: []byte("---\n{{.}}: [\n---\nbody")},
+		"meta.html.tpl": {Data: []byte("---\ntitle: HTML\n---\nbody")},
+		"meta.md":       {Data: []byte("---\ntitle: Markdown\n---\nbody")},
+	}
+
+	// In a text engine, text templates keep their first YAML document.
+	e, err := NewTextEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	if out, err := e.Render("cfg.yaml.tpl", "one"); err != nil || out != "---\nname: one\n---\nname: two\n" {
+		t.Errorf("Expected the YAML to be untouched, got %q (%v)", out, err)
+	}
+	if m, _ := e.Meta("meta.html.tpl"); m.Title != "HTML" {
+		t.Errorf("Expected HTML templates to have front matter, got %+v", m)
+	}
+	if m, _ := e.Meta("meta.md"); m.Title != "Markdown" {
+		t.Errorf("Expected Markdown templates to have front matter, got %+v", m)
+	}
+
+	e, err = NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	if out, err := e.Render("cfg.txt.tpl", "one"); err != nil || out != "---\nname: one\n---\nname: two\n" {
+		t.Errorf("Expected the YAML to be untouched, got %q (%v)", out, err)
+	}
+	// A block that doesn't parse is not front matter.
+	if out, err := e.Render("invalid.tpl", "x"); err != nil || out != "---\nx: [\n---\nbody" {
+		t.Errorf("Expected the block to be untouched, got %q (%v)", out, err)
+	}
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// AssetHandler returns an http.Handler that serves assets.
+//
+// The prefix is removed from the request path, and the remainder is located
+// with OpenAsset, so assets are served from the first theme that supplies
+// them. Templates, manifests, stray files (see StrayFilePatterns), and
+// illegal names are refused with 403 Forbidden, and
+// assets that cannot be found (including directories) are reported with 404
+// Not Found.
+//
+// Assets are served with http.ServeContent, which sets the Content-Type and
+// handles conditional and range requests. Each asset's ETag is derived from
+// its contents.
+//
+// Fingerprinted names, as returned by Fingerprint, are served as the original
+// asset, provided that the fingerprint matches the asset's current contents.
+// These responses are marked as immutable so that browsers can cache them
+// indefinitely.
+//
+// Bundles declared with Bundle or in a theme manifest are served as well.
+//
+//	http.Handle("/assets/", e.AssetHandler("/assets/"))
+func (e *Engine) AssetHandler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+
+		// A fingerprinted name that matches the current contents of the
+		// asset will never change, so it can be cached for good.
+		immutable := false
+		if orig, fp, ok := unfingerprint(name); ok {
+			if dg, err := e.digest(orig); err == nil && dg.fingerprint() == fp {
+				name = orig
+				immutable = true
+			}
+		}
+
+		setHeaders := func() {
+			if dg, err := e.digest(name); err == nil {
+				w.Header().Set("ETag", fmt.Sprintf(`"%x"`, dg.sum[:16]))
+			}
+			if immutable {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			}
+		}
+
+		b, err := e.bundle(name)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if b != nil {
+			setHeaders()
+			http.ServeContent(w, r, path.Base(name), time.Time{}, bytes.NewReader(b.data))
+			return
+		}
+
+		f, err := e.OpenAsset(name)
+		switch err {
+		case nil:
+		case IllegalName:
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		case NoAssetFound:
+			http.NotFound(w, r)
+			return
+		default:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if fi.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		content, err := readSeeker(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		setHeaders()
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), content)
+	})
+}
+
+// readSeeker returns f as an io.ReadSeeker, reading it into memory if f
+// cannot seek.
+func readSeeker(f fs.File) (io.ReadSeeker, error) {
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// ServeTemplate renders a template as the response to an HTTP request.
+//
+// The Content-Type header is taken from the template's front matter (see
+// Meta). Without one, text templates are served as text/plain, and others as
+// text/html. If the front matter sets a cache time, it is used for the
+// Cache-Control header.
+//
+// The template is rendered before anything is written, so if rendering
+// fails, the error is returned and w is untouched, leaving the caller free to
+// report it.
+func (e *Engine) ServeTemplate(w http.ResponseWriter, name string, data interface{}) error {
+	set := e.templates()
+	sp, key, err := e.lookupView(set, name)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = e.executePage(&buf, set, sp, sp.master, key, data, nil)
+	if err := e.renderError(set, sp, name, key, err); err != nil {
+		return err
+	}
+
+	ctype := "text/html; charset=utf-8"
+	if sp.text && !isMarkdown(key) {
+		ctype = "text/plain; charset=utf-8"
+	}
+	if m, ok := set.meta[key]; ok {
+		if m.ContentType != "" {
+			ctype = m.ContentType
+		}
+		if m.Cache > 0 {
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(m.Cache.Seconds())))
+		}
+	}
+	w.Header().Set("Content-Type", ctype)
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssetHandler(t *testing.T) {
+	e, err := New("testdata/override", "testdata/base")
+	if err != nil {
+		t.Fatalf("Failed parse of testdata: %s", err)
+	}
+	h := e.AssetHandler("/assets/")
+
+	data := map[string]int{
+		"/assets/asset.dat":             http.StatusOK,
+		"/assets/simple.tpl":            http.StatusForbidden,
+		"/assets/../engine.go":          http.StatusForbidden,
+		"/assets/nope.dat":              http.StatusNotFound,
+		"/assets/partials":              http.StatusNotFound,
+		"/elsewhere/asset.dat":          http.StatusNotFound,
+		"/assets/partials/../asset.dat": http.StatusOK,
+	}
+	for p, code := range data {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = p
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != code {
+			t.Errorf("Expected %d for %s, got %d", code, p, res.Code)
+		}
+	}
+
+	mem := fstest.MapFS{
+		"theme.json":     {Data: []byte(`{"settings": {"key": "secret"}}`)},
+		"page.tpl~":      {Data: []byte(`{{.}}`)},
+		"css/site.css":   {Data: []byte(`body{}`)},
+		"css/theme.json": {Data: []byte(`{}`)},
+	}
+	fe, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	fh := fe.AssetHandler("/")
+	for p, code := range map[string]int{
+		"/theme.json":     http.StatusForbidden,
+		"/page.tpl~":      http.StatusForbidden,
+		"/css/site.css":   http.StatusOK,
+		"/css/theme.json": http.StatusOK,
+	} {
+		res := httptest.NewRecorder()
+		fh.ServeHTTP(res, httptest.NewRequest("GET", p, nil))
+		if res.Code != code {
+			t.Errorf("Expected %d for %s, got %d", code, p, res.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/assets/asset.dat", nil)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	etag := res.Header().Get("ETag")
+	if etag == "" {
+		t.Error("Expected an ETag")
+	}
+	if res.Header().Get("Content-Type") == "" {
+		t.Error("Expected a Content-Type")
+	}
+
+	req = httptest.NewRequest("GET", "/assets/asset.dat", nil)
+	req.Header.Set("If-None-Match", etag)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", res.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/assets/asset.dat", strings.NewReader(""))
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", res.Code)
+	}
+}
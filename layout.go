@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+)
+
+// RenderWithLayout renders a page inside of a layout.
+//
+// The page and the layout are both located the same way that Render locates
+// templates, so a theme can override the layout without overriding the page,
+// or the other way around.
+//
+// The layout is executed with the given data. Named templates that the page
+// defines take precedence over any others with the same name, so a page can
+// fill in the blocks of a layout:
+//
+//	layout.tpl:
+//		<html><body>{{block "content" .}}Nothing here.{{end}}</body></html>
+//
+//	page.tpl:
+//		{{define "content"}}Hello, {{.}}!{{end}}
+//
+// Since every page supplies its own definitions, any number of pages can
+// define a "content" block without conflict.
+func (e *Engine) RenderWithLayout(page, layout string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	err := e.RenderWithLayoutTo(&buf, page, layout, data)
+	return buf.String(), err
+}
+
+// RenderWithLayoutTo renders a page inside of a layout, writing the output to w.
+//
+// It is the streaming counterpart of RenderWithLayout, and behaves like
+// RenderTo.
+func (e *Engine) RenderWithLayoutTo(w io.Writer, page, layout string, data interface{}) error {
+	set := e.templates()
+	_, pkey, err := e.lookup(set, page)
+	if err != nil {
+		return err
+	}
+	sp, lkey, err := e.lookupView(set, layout)
+	if err != nil {
+		return err
+	}
+
+	t, err := sp.layout(pkey, set.sources[pkey], e.funcs)
+	if err != nil {
+		return err
+	}
+	err = e.execute(w, t, lkey, data, e.debugLabel(sp, pkey+" in "+lkey))
+	return e.renderError(set, sp, layout, lkey, err)
+}
+
+// layout returns a copy of master in which the named templates defined by
+// the page with the given key and source take precedence.
+//
+// Copies are built on first use and cached.
+func (s *space) layout(page, src string, funcs template.FuncMap) (namespace, error) {
+	s.layoutsMx.Lock()
+	defer s.layoutsMx.Unlock()
+
+	if t, ok := s.layouts[page]; ok {
+		return t, nil
+	}
+	t, err := s.newLayout(page, src, funcs)
+	if err != nil {
+		return nil, err
+	}
+	s.layouts[page] = t
+	return t, nil
+}
+
+// newLayout builds an uncached copy of master for layout.
+func (s *space) newLayout(page, src string, funcs template.FuncMap) (namespace, error) {
+	t, err := s.proto.Clone()
+	if err != nil {
+		return nil, err
+	}
+	// Reparsing the page replaces any definitions of the same name that
+	// came from other files. Named templates (as opposed to files) have no
+	// source of their own, and are already in effect.
+	if src != "" {
+		trees, err := parseTrees(page, src, funcs)
+		if err != nil {
+			return nil, err
+		}
+		for name, tree := range trees {
+			if s.debug {
+				tree = debugTree(tree)
+			}
+			if err := t.AddParseTree(name, tree); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
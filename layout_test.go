@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderWithLayout(t *testing.T) {
+	child := fstest.MapFS{
+		"layouts/main.tpl": {Data: []byte(`<main>{{block "content" .}}empty{{end}}</main>`)},
+	}
+	parent := fstest.MapFS{
+		"layouts/main.tpl": {Data: []byte(`<div>{{block "content" .}}empty{{end}}</div>`)},
+		"one.tpl":          {Data: []byte(`{{define "content"}}one:{{.}}{{end}}`)},
+		"two.tpl":          {Data: []byte(`{{define "content"}}two:{{.}}{{end}}`)},
+		"none.tpl":         {Data: []byte(`nothing to see here`)},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	expect := map[string]string{
+		"one.tpl":  "<main>one:test</main>",
+		"two.tpl":  "<main>two:test</main>",
+		"none.tpl": "<main>empty</main>",
+	}
+	// Render twice to exercise the cached copies.
+	for i := 0; i < 2; i++ {
+		for page, e2 := range expect {
+			out, err := e.RenderWithLayout(page, "layouts/main.tpl", "test")
+			if err != nil {
+				t.Errorf("Failed render of %s: %s", page, err)
+			}
+			if out != e2 {
+				t.Errorf("Expected %q, got %q", e2, out)
+			}
+		}
+	}
+
+	// Rendering the page on its own is unaffected.
+	out, err := e.Render("one.tpl", "test")
+	if err != nil || out != "" {
+		t.Errorf("Expected empty output, got %q (%v)", out, err)
+	}
+
+	if _, err := e.RenderWithLayout("nope.tpl", "layouts/main.tpl", nil); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+	if _, err := e.RenderWithLayout("one.tpl", "nope.tpl", nil); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// LintKind identifies a kind of problem found by Lint.
+type LintKind string
+
+const (
+	// IdenticalOverride is a template that overrides one in a later theme
+	// with exactly the same content, and so could be removed.
+	IdenticalOverride LintKind = "identical-override"
+	// UndefinedTemplate is a {{template}} call to a name that no theme
+	// defines.
+	UndefinedTemplate LintKind = "undefined-template"
+	// DefineCollision is a named template that is defined by more than one
+	// theme. Only the first theme's definition is used.
+	DefineCollision LintKind = "define-collision"
+	// MissingAsset is a call to the asset or assetSRI function for an asset
+	// that does not exist.
+	MissingAsset LintKind = "missing-asset"
+	// StrayFile is a file that looks like it was left behind by an editor
+	// or tool. See StrayFilePatterns.
+	StrayFile LintKind = "stray-file"
+)
+
+// StrayFilePatterns are the patterns used by Lint to find files that are
+// neither templates nor assets. They are matched against the base name of
+// each file with path.Match.
+var StrayFilePatterns = []string{
+	"*~", "*.bak", "*.orig", "*.rej", "*.swp", "*.swo", "*.tmp",
+	".#*", "#*#", ".DS_Store", "Thumbs.db",
+}
+
+// Diagnostic is a problem found by Lint.
+type Diagnostic struct {
+	Kind LintKind
+	// Path is the file with the problem.
+	Path string
+	// Line is the line of Path where the problem is, or zero.
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s (%s)", d.Path, d.Line, d.Message, d.Kind)
+	}
+	return fmt.Sprintf("%s: %s (%s)", d.Path, d.Message, d.Kind)
+}
+
+// Lint looks for problems in the themes that don't stop the templates from
+// rendering, but that are likely to be mistakes or leftovers. See LintKind
+// for the problems that are found.
+//
+// Diagnostics are sorted by path and line. The returned error reports a
+// failure to read the themes, not the problems found.
+func (e *Engine) Lint() ([]Diagnostic, error) {
+	set := e.templates()
+	var res []Diagnostic
+
+	// defs records the themes and files that define each named template.
+	// HTML and text templates share their named templates, so they are
+	// compared with each other.
+	type def struct{ theme, file string }
+	defs := map[string][]def{}
+
+	for i, d := range set.dirs {
+		for _, rel := range sortedKeys(set.cache[d]) {
+			if strings.Contains(rel, NamedTemplateSeparator) {
+				continue
+			}
+			f := filepath.Join(d, rel)
+			src := set.sources[f]
+			sp := set.files[f]
+
+			for _, o := range set.dirs[i+1:] {
+				if !set.cache[o][rel] {
+					continue
+				}
+				// The sources have had their front matter removed, so the
+				// files themselves are compared.
+				same, err := sameFile(set, d, o, rel)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					res = append(res, Diagnostic{Kind: IdenticalOverride, Path: f,
+						Message: fmt.Sprintf("identical to %s", filepath.Join(o, rel))})
+				}
+				break
+			}
+
+			trees, err := parseTrees(f, src, e.funcs)
+			if err != nil {
+				return nil, err
+			}
+			names := make([]string, 0, len(trees))
+			for tname := range trees {
+				names = append(names, tname)
+			}
+			sort.Strings(names)
+			for _, tname := range names {
+				tree := trees[tname]
+				if tname != f && tree.Root != nil {
+					defs[tname] = append(defs[tname], def{d, f})
+				}
+				walkNodes(tree.Root, func(n parse.Node) {
+					res = append(res, e.lintNode(sp, tree, n)...)
+				})
+			}
+		}
+
+		err := fs.WalkDir(set.fsys[d], ".", func(p string, de fs.DirEntry, err error) error {
+			if err != nil || de.IsDir() {
+				return err
+			}
+			if isStray(p) {
+				res = append(res, Diagnostic{Kind: StrayFile, Path: filepath.Join(d, filepath.FromSlash(p)),
+					Message: "looks like a stray file"})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ds := defs[name]
+		themes := map[string]bool{}
+		for _, x := range ds {
+			themes[x.theme] = true
+		}
+		if len(themes) < 2 {
+			continue
+		}
+		for _, x := range ds[1:] {
+			if x.theme == ds[0].theme {
+				continue
+			}
+			res = append(res, Diagnostic{Kind: DefineCollision, Path: x.file,
+				Message: fmt.Sprintf("template %q is also defined in %s, which is used instead", name, ds[0].file)})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Path != res[j].Path {
+			return res[i].Path < res[j].Path
+		}
+		return res[i].Line < res[j].Line
+	})
+	return res, nil
+}
+
+// sameFile reports whether the file rel has the same content in the themes
+// d and o.
+func sameFile(set *templateSet, d, o, rel string) (bool, error) {
+	a, err := fs.ReadFile(set.fsys[d], filepath.ToSlash(rel))
+	if err != nil {
+		return false, err
+	}
+	b, err := fs.ReadFile(set.fsys[o], filepath.ToSlash(rel))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(a, b), nil
+}
+
+// lintNode checks a single node of a template in the space sp.
+func (e *Engine) lintNode(sp *space, tree *parse.Tree, node parse.Node) []Diagnostic {
+	switch n := node.(type) {
+	case *parse.TemplateNode:
+		if sp.proto.tree(n.Name) == nil {
+			return []Diagnostic{nodeDiagnostic(tree, n, UndefinedTemplate,
+				fmt.Sprintf("template %q is not defined", n.Name))}
+		}
+	case *parse.CommandNode:
+		if len(n.Args) < 2 {
+			return nil
+		}
+		fn, ok := n.Args[0].(*parse.IdentifierNode)
+		if !ok || (fn.Ident != "asset" && fn.Ident != "assetSRI") {
+			return nil
+		}
+		s, ok := n.Args[1].(*parse.StringNode)
+		if !ok {
+			return nil
+		}
+		if _, err := e.digest(s.Text); err != nil {
+			return []Diagnostic{nodeDiagnostic(tree, n, MissingAsset,
+				fmt.Sprintf("asset %q: %s", s.Text, err))}
+		}
+	}
+	return nil
+}
+
+// nodeDiagnostic creates a Diagnostic for a node in tree.
+func nodeDiagnostic(tree *parse.Tree, n parse.Node, kind LintKind, msg string) Diagnostic {
+	d := Diagnostic{Kind: kind, Path: tree.ParseName, Message: msg}
+	// The location has the form name:line:column.
+	loc, _ := tree.ErrorContext(n)
+	if parts := strings.Split(loc, ":"); len(parts) >= 3 {
+		d.Line, _ = strconv.Atoi(parts[len(parts)-2])
+	}
+	return d
+}
+
+// walkNodes calls fn for node and every node beneath it.
+func walkNodes(node parse.Node, fn func(parse.Node)) {
+	switch n := node.(type) {
+	case nil:
+		return
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		fn(n)
+		for _, c := range n.Nodes {
+			walkNodes(c, fn)
+		}
+		return
+	case *parse.ActionNode:
+		fn(n)
+		walkNodes(n.Pipe, fn)
+		return
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		fn(n)
+		for _, c := range n.Cmds {
+			walkNodes(c, fn)
+		}
+		return
+	case *parse.CommandNode:
+		fn(n)
+		for _, a := range n.Args {
+			walkNodes(a, fn)
+		}
+		return
+	case *parse.TemplateNode:
+		fn(n)
+		walkNodes(n.Pipe, fn)
+		return
+	case *parse.IfNode:
+		fn(n)
+		walkNodes(n.Pipe, fn)
+		walkNodes(n.List, fn)
+		walkNodes(n.ElseList, fn)
+		return
+	case *parse.RangeNode:
+		fn(n)
+		walkNodes(n.Pipe, fn)
+		walkNodes(n.List, fn)
+		walkNodes(n.ElseList, fn)
+		return
+	case *parse.WithNode:
+		fn(n)
+		walkNodes(n.Pipe, fn)
+		walkNodes(n.List, fn)
+		walkNodes(n.ElseList, fn)
+		return
+	}
+	fn(node)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
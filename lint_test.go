@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLint(t *testing.T) {
+	child := fstest.MapFS{
+		"same.tpl":     {Data: []byte(`same`)},
+		"changed.tpl":  {Data: []byte(`child`)},
+		"matter.tpl":   {Data: []byte("---\nlayout: a.tpl\n---\nsame")},
+		"calls.tpl":    {Data: []byte("ok {{template \"name\"}}\n{{if .}}{{template \"nope\" .}}{{end}}")},
+		"assets.tpl":   {Data: []byte("{{asset \"site.css\"}}\n{{assetSRI \"gone.js\"}}\n{{asset \"all.css\"}}")},
+		"names.tpl":    {Data: []byte(`{{define "name"}}child{{end}}`)},
+		"mail.txt.tpl": {Data: []byte(`{{define "sig"}}child{{end}}`)},
+		"site.css":     {Data: []byte(`body{}`)},
+		"page.tpl~":    {Data: []byte(`backup`)},
+		"css/.#x.css":  {Data: []byte(`lock`)},
+		"theme.json":   {Data: []byte(`{"bundles": {"all.css": ["site.css"]}}`)},
+	}
+	parent := fstest.MapFS{
+		"same.tpl":    {Data: []byte(`same`)},
+		"changed.tpl": {Data: []byte(`parent`)},
+		// Only the front matter differs, so this is not identical.
+		"matter.tpl": {Data: []byte("---\nlayout: b.tpl\n---\nsame")},
+		"other.tpl":  {Data: []byte(`{{define "name"}}parent{{end}}{{define "only"}}{{end}}`)},
+		"sig.tpl":    {Data: []byte(`{{define "sig"}}parent{{end}}{{template "sig"}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	diags, err := e.Lint()
+	if err != nil {
+		t.Fatalf("Failed to lint: %s", err)
+	}
+	expect := []Diagnostic{
+		{MissingAsset, "fs0/assets.tpl", 2, ""},
+		{UndefinedTemplate, "fs0/calls.tpl", 2, ""},
+		{StrayFile, "fs0/css/.#x.css", 0, ""},
+		{StrayFile, "fs0/page.tpl~", 0, ""},
+		{IdenticalOverride, "fs0/same.tpl", 0, ""},
+		{DefineCollision, "fs1/other.tpl", 0, ""},
+		// Text and HTML templates share named templates.
+		{DefineCollision, "fs1/sig.tpl", 0, ""},
+	}
+	if len(diags) != len(expect) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expect), len(diags), diags)
+	}
+	for i, d := range diags {
+		x := expect[i]
+		if d.Kind != x.Kind || d.Path != x.Path || d.Line != x.Line {
+			t.Errorf("Expected %s at %s:%d, got %s", x.Kind, x.Path, x.Line, d)
+		}
+	}
+	if s := diags[1].String(); !strings.Contains(s, `"nope"`) {
+		t.Errorf("Expected the message to name the template, got %q", s)
+	}
+}
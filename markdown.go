@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"path"
+	"strings"
+	"text/template/parse"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// MarkdownBlock is the name of the block that a Markdown template's HTML is
+// placed in when it is rendered in a layout. See MarkdownLayout.
+var MarkdownBlock = "content"
+
+// markdown converts Markdown to HTML. GitHub Flavored Markdown is supported.
+// Raw HTML in the Markdown is omitted.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// isMarkdown returns true if the template name is written in Markdown. This
+// is the case if it has the extension .md, either as its template extension
+// or just before it, as in page.md.tpl.
+func isMarkdown(name string) bool {
+	ext := path.Ext(name)
+	return ext == ".md" || path.Ext(strings.TrimSuffix(name, ext)) == ".md"
+}
+
+// executeMarkdown executes the Markdown template key in t, converts the
+// result to HTML, and renders the HTML in layout, if it is not empty. If
+// bound is not nil, the layout uses its functions, as in executePage.
+func (e *Engine) executeMarkdown(w io.Writer, set *templateSet, t namespace, key, layout string, data interface{}, bound template.FuncMap) error {
+	var src, out bytes.Buffer
+	if err := t.ExecuteTemplate(&src, key, data); err != nil {
+		return err
+	}
+	if err := markdown.Convert(src.Bytes(), &out); err != nil {
+		return err
+	}
+
+	if layout == "" {
+		_, err := out.WriteTo(w)
+		return err
+	}
+	lsp, lkey, err := e.lookupView(set, layout)
+	if err != nil {
+		return err
+	}
+	lt, err := lsp.proto.Clone()
+	if err != nil {
+		return err
+	}
+	if bound != nil {
+		lt.Funcs(bound)
+	}
+	// The HTML is added as a template consisting of a single text node, so
+	// that it is neither escaped nor executed.
+	trees, err := parseTrees(key, "html", nil)
+	if err != nil {
+		return err
+	}
+	tree := trees[key]
+	tree.Root.Nodes[0].(*parse.TextNode).Text = out.Bytes()
+	if err := lt.AddParseTree(MarkdownBlock, tree); err != nil {
+		return err
+	}
+	return e.execute(w, lt, lkey, data, e.debugLabel(lsp, key+" in "+lkey))
+}
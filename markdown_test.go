@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+	"io/fs"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMarkdown(t *testing.T) {
+	child := fstest.MapFS{
+		"docs/intro.md":     {Data: []byte("# {{.}}\n\nSome *text* & <b>{{.}}</b>.\n")},
+		"docs/guide.md.tpl": {Data: []byte("- {{.}}\n")},
+		"layout.tpl":        {Data: []byte(`<main>{{block "content" .}}{{end}}</main><p>{{.}}</p>`)},
+	}
+	parent := fstest.MapFS{
+		"docs/intro.md": {Data: []byte("parent")},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	expectRender(t, e, "docs/guide.md.tpl", "<ul>\n<li>test</li>\n</ul>")
+
+	// Markdown source is never served as an asset, even if .md is not a
+	// template extension.
+	for _, exts := range [][]string{e.Extensions(), {".tpl"}} {
+		if err := e.SetExtensions(exts...); err != nil {
+			t.Fatalf("Failed to set extensions: %s", err)
+		}
+		if _, err := e.Asset("docs/intro.md"); err != IllegalName {
+			t.Errorf("Expected IllegalName with %v, got %v", exts, err)
+		}
+		res := httptest.NewRecorder()
+		e.AssetHandler("/").ServeHTTP(res, httptest.NewRequest("GET", "/docs/intro.md", nil))
+		if res.Code != 403 {
+			t.Errorf("Expected 403 with %v, got %d", exts, res.Code)
+		}
+	}
+	if err := e.SetExtensions(".tpl", ".md"); err != nil {
+		t.Fatalf("Failed to set extensions: %s", err)
+	}
+	// Raw HTML is left out of the output.
+	intro := "<h1>a&lt;b</h1>\n<p>Some <em>text</em> &amp; <!-- raw HTML omitted -->a&lt;b<!-- raw HTML omitted -->.</p>\n"
+	out, err := e.Render("docs/intro.md", "a<b")
+	if err != nil {
+		t.Fatalf("Failed render: %s", err)
+	}
+	if out != intro {
+		t.Errorf("Expected %q, got %q", intro, out)
+	}
+	if out, err := e.RenderContext(context.Background(), "docs/intro.md", "a<b"); err != nil || out != intro {
+		t.Errorf("Expected %q, got %q (%v)", intro, out, err)
+	}
+
+	e.MarkdownLayout = "layout.tpl"
+	expect := "<main><ul>\n<li>x&amp;y</li>\n</ul>\n</main><p>x&amp;y</p>"
+	if out, err := e.Render("docs/guide.md.tpl", "x&y"); err != nil || out != expect {
+		t.Errorf("Expected %q, got %q (%v)", expect, out, err)
+	}
+
+	e.MarkdownLayout = "nope.tpl"
+	if _, err := e.Render("docs/guide.md.tpl", nil); err == nil {
+		t.Error("Expected a missing layout to fail")
+	}
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memFS is a read-only, in-memory file system. See AddTheme.
+type memFS struct {
+	// files maps each file and directory to its information. The root is
+	// ".".
+	files map[string]*memInfo
+	// dirs maps each directory to its entries, in order.
+	dirs map[string][]fs.DirEntry
+}
+
+// newMemFS creates a memFS holding files, which maps slash-separated paths
+// to their contents. Every path must be valid according to fs.ValidPath.
+func newMemFS(files map[string]string) *memFS {
+	now := time.Now()
+	m := &memFS{
+		files: map[string]*memInfo{".": {name: ".", mod: now, dir: true}},
+		dirs:  map[string][]fs.DirEntry{},
+	}
+	for name, data := range files {
+		m.files[name] = &memInfo{name: path.Base(name), data: data, mod: now}
+		for d := path.Dir(name); ; d = path.Dir(d) {
+			if _, ok := m.files[d]; !ok {
+				m.files[d] = &memInfo{name: path.Base(d), mod: now, dir: true}
+			}
+			if d == "." {
+				break
+			}
+		}
+	}
+	for name, fi := range m.files {
+		if name != "." {
+			d := path.Dir(name)
+			m.dirs[d] = append(m.dirs[d], fi)
+		}
+	}
+	for _, entries := range m.dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+	return m
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	fi, ok := m.files[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if fi.dir {
+		return &memDir{info: fi, entries: m.dirs[name]}, nil
+	}
+	return &memFile{info: fi, Reader: strings.NewReader(fi.data)}, nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fi, ok := m.files[name]
+	if !ok || !fi.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry(nil), m.dirs[name]...), nil
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	fi, ok := m.files[name]
+	if !ok || fi.dir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return []byte(fi.data), nil
+}
+
+// memInfo describes a file or directory in a memFS. It serves as both its
+// fs.FileInfo and its fs.DirEntry.
+type memInfo struct {
+	name string
+	data string
+	mod  time.Time
+	dir  bool
+}
+
+func (i *memInfo) Name() string               { return i.name }
+func (i *memInfo) Size() int64                { return int64(len(i.data)) }
+func (i *memInfo) ModTime() time.Time         { return i.mod }
+func (i *memInfo) IsDir() bool                { return i.dir }
+func (i *memInfo) Sys() interface{}           { return nil }
+func (i *memInfo) Info() (fs.FileInfo, error) { return i, nil }
+func (i *memInfo) Type() fs.FileMode          { return i.Mode().Type() }
+
+func (i *memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// memFile is an open file in a memFS.
+type memFile struct {
+	info *memInfo
+	*strings.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+// memDir is an open directory in a memFS.
+type memDir struct {
+	info    *memInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return append([]fs.DirEntry(nil), rest...), nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return append([]fs.DirEntry(nil), rest[:n]...), nil
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemFS(t *testing.T) {
+	m := newMemFS(map[string]string{
+		"a.tpl":         "a",
+		"css/site.css":  "body{}",
+		"css/x/y/z.css": "z",
+	})
+	if err := fstest.TestFS(m, "a.tpl", "css/site.css", "css/x/y/z.css"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddTheme(t *testing.T) {
+	e, err := New("testdata/base", "testdata/override")
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	// An override at the top.
+	err = e.AddTheme("top", map[string]string{
+		"partials/header.tpl": `top header {{template "greeting"}}`,
+		"names.tpl":           `{{define "greeting"}}hi{{end}}`,
+		"site.css":            `body{}`,
+	}, 0)
+	if err != nil {
+		t.Fatalf("Failed to add theme: %s", err)
+	}
+	// Defaults at the bottom.
+	err = e.AddTheme("bottom", map[string]string{
+		"partials/header.tpl": `bottom`,
+		"partials/extra.tpl":  `extra`,
+		"names.tpl":           `{{define "greeting"}}bottom{{end}}`,
+	}, 99)
+	if err != nil {
+		t.Fatalf("Failed to add theme: %s", err)
+	}
+
+	dirs := e.Dirs()
+	if len(dirs) != 4 || dirs[0] != "top" || dirs[3] != "bottom" {
+		t.Errorf("Unexpected dirs %v", dirs)
+	}
+	expectRender(t, e, "partials/header.tpl", "top header hi")
+	expectRender(t, e, "partials/extra.tpl", "extra")
+	expectRender(t, e, "#greeting", "hi")
+	if a, err := e.Asset("site.css"); err != nil || a != "top/site.css" {
+		t.Errorf("Expected top/site.css, got %q (%v)", a, err)
+	}
+	if _, err := e.Fingerprint("site.css"); err != nil {
+		t.Errorf("Failed to fingerprint: %s", err)
+	}
+	found := false
+	for _, p := range e.Paths() {
+		found = found || p == "bottom/partials/extra.tpl"
+	}
+	if !found {
+		t.Errorf("Expected bottom/partials/extra.tpl in %v", e.Paths())
+	}
+
+	// Reloading keeps the added themes.
+	if err := e.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %s", err)
+	}
+	expectRender(t, e, "partials/extra.tpl", "extra")
+
+	if err := e.AddTheme("top", nil, 0); err == nil {
+		t.Error("Expected a duplicate name to fail")
+	}
+	if err := e.AddTheme("bad", map[string]string{"../x.tpl": ""}, 0); !errors.Is(err, IllegalName) {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+	if err := e.AddTheme("bad", map[string]string{"a": "", "a/b": ""}, 0); !errors.Is(err, IllegalName) {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+	if err := e.AddTheme("broken", map[string]string{"x.tpl": "{{if}}"}, 0); err == nil {
+		t.Error("Expected a broken template to fail")
+	}
+	if len(e.Dirs()) != 4 {
+		t.Errorf("Expected failed themes not to be added, got %v", e.Dirs())
+	}
+
+	// Themes can be added while rendering.
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 50; i++ {
+			e.Render("partials/header.tpl", nil)
+			e.Asset("site.css")
+		}
+		done <- true
+	}()
+	for i := 0; i < 5; i++ {
+		if err := e.AddTheme(fmt.Sprint("more", i), map[string]string{"more.tpl": "more"}, i); err != nil {
+			t.Errorf("Failed to add theme: %s", err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+)
+
+// The minifiers here are deliberately simple. They remove comments and
+// unneeded whitespace, and nothing else. They never rename, reorder, or
+// rewrite anything, so while the savings are modest, the output behaves
+// exactly like the input.
+
+// minifyCSS removes comments and collapses whitespace in a stylesheet.
+func minifyCSS(src []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(src))
+
+	// space records that whitespace (or a comment) has been skipped, and a
+	// single space may need to be written before the next token.
+	space := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return out.Bytes()
+			}
+			i += end + 3
+			space = true
+			continue
+		case isSpace(c):
+			space = true
+			continue
+		}
+
+		// Whitespace is never needed next to punctuation. A space before
+		// a colon is kept, though, since 'a :hover' and 'a:hover' are
+		// different selectors.
+		if space && out.Len() > 0 && !strings.ContainsRune("{};,>:", rune(lastByte(&out))) && !strings.ContainsRune("{};,>", rune(c)) {
+			out.WriteByte(' ')
+		}
+		space = false
+
+		if c == '"' || c == '\'' {
+			i = copyString(&out, src, i)
+		} else {
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// minifyJS removes comments and indentation from a script.
+//
+// Line breaks are kept, since JavaScript's automatic semicolon insertion
+// depends on them, but blank lines are removed.
+func minifyJS(src []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(src))
+
+	space, newline := false, false
+	// last is the last significant character written, which tells us
+	// whether a slash starts a regular expression or is division.
+	var last byte
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			newline = true
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return out.Bytes()
+			}
+			if bytes.IndexByte(src[i:i+end+4], '\n') >= 0 {
+				newline = true
+			} else {
+				space = true
+			}
+			i += end + 3
+			continue
+		case c == '\n' || c == '\r':
+			newline = true
+			continue
+		case isSpace(c):
+			space = true
+			continue
+		}
+
+		if out.Len() > 0 {
+			if newline {
+				out.WriteByte('\n')
+			} else if space {
+				out.WriteByte(' ')
+			}
+		}
+		space, newline = false, false
+
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			i = copyString(&out, src, i)
+		case c == '/' && startsRegexp(last, lastWord(&out)):
+			i = copyRegexp(&out, src, i)
+		default:
+			out.WriteByte(c)
+		}
+		last = c
+	}
+	return out.Bytes()
+}
+
+// copyString copies the quoted string starting at src[i] to out, returning
+// the index of the closing quote.
+func copyString(out *bytes.Buffer, src []byte, i int) int {
+	q := src[i]
+	out.WriteByte(q)
+	for i++; i < len(src); i++ {
+		out.WriteByte(src[i])
+		if src[i] == '\\' && i+1 < len(src) {
+			i++
+			out.WriteByte(src[i])
+			continue
+		}
+		if src[i] == q {
+			break
+		}
+	}
+	return i
+}
+
+// copyRegexp copies the regular expression literal starting at src[i] to out,
+// returning the index of its last character.
+func copyRegexp(out *bytes.Buffer, src []byte, i int) int {
+	out.WriteByte(src[i])
+	class := false
+	for i++; i < len(src); i++ {
+		c := src[i]
+		out.WriteByte(c)
+		switch {
+		case c == '\\' && i+1 < len(src):
+			i++
+			out.WriteByte(src[i])
+		case c == '[':
+			class = true
+		case c == ']':
+			class = false
+		case c == '/' && !class:
+			// Copy any flags.
+			for i+1 < len(src) && isIdent(src[i+1]) {
+				i++
+				out.WriteByte(src[i])
+			}
+			return i
+		case c == '\n':
+			// Not a regular expression after all.
+			return i
+		}
+	}
+	return i
+}
+
+// regexpKeywords are the keywords after which a slash begins a regular
+// expression, as in "return /x/.test(s)".
+var regexpKeywords = map[string]bool{
+	"await": true, "case": true, "delete": true, "do": true, "else": true,
+	"in": true, "instanceof": true, "of": true, "return": true,
+	"throw": true, "typeof": true, "void": true, "yield": true,
+}
+
+// startsRegexp returns true if a slash following the character last, which
+// ends word if it is part of one, begins a regular expression rather than a
+// division.
+func startsRegexp(last byte, word string) bool {
+	if isIdent(last) {
+		return regexpKeywords[word]
+	}
+	return last == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", last) >= 0
+}
+
+// lastWord returns the identifier or keyword at the end of the output so
+// far, ignoring any whitespace after it. A property name, as in "a.return",
+// is not a keyword, so it is not returned.
+func lastWord(b *bytes.Buffer) string {
+	s := bytes.TrimRight(b.Bytes(), " \n")
+	i := len(s)
+	for i > 0 && isIdent(s[i-1]) {
+		i--
+	}
+	if i > 0 && s[i-1] == '.' {
+		return ""
+	}
+	return string(s[i:])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$'
+}
+
+func lastByte(b *bytes.Buffer) byte {
+	return b.Bytes()[b.Len()-1]
+}
@@ -0,0 +1,42 @@
+package engine
+
+import "testing"
+
+func TestMinifyCSS(t *testing.T) {
+	data := map[string]string{
+		"body {\n  color: red;\n}\n":               "body{color:red;}",
+		"/* comment */ a , b > c { x: y }":         "a,b>c{x:y}",
+		"a::before { content: \"  /* not */  \" }": "a::before{content:\"  /* not */  \"}",
+		"a :hover {}":          "a :hover{}",
+		"div   p {}":           "div p{}",
+		"a { margin: 0 auto }": "a{margin:0 auto}",
+		"/* unterminated":      "",
+	}
+	for in, expect := range data {
+		if out := string(minifyCSS([]byte(in))); out != expect {
+			t.Errorf("Expected %q, got %q", expect, out)
+		}
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	data := map[string]string{
+		"var a = 1; // one\n\n\n  var b = 2;": "var a = 1;\nvar b = 2;",
+		"/* block */\nfoo();\n":               "foo();",
+		"var s = '// not a comment';":         "var s = '// not a comment';",
+		"var re = /\\/\\//g; // slashes":      "var re = /\\/\\//g;",
+		"var re = /[/]/; x = a / b / c;":      "var re = /[/]/; x = a / b / c;",
+		"var t = `a   /* b */   c`;":          "var t = `a   /* b */   c`;",
+		"return\n  x":                         "return\nx",
+		"a /* inline */ + b":                  "a + b",
+		"return /\\/\\//.test(x); // url":     "return /\\/\\//.test(x);",
+		"if (typeof /a/ == s) throw /b/":      "if (typeof /a/ == s) throw /b/",
+		"x = a.return / 2 // half":            "x = a.return / 2",
+		"x = returned / 2 / 1":                "x = returned / 2 / 1",
+	}
+	for in, expect := range data {
+		if out := string(minifyJS([]byte(in))); out != expect {
+			t.Errorf("Expected %q, got %q", expect, out)
+		}
+	}
+}
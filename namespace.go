@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"html/template"
+	"io"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// namespace is a collection of associated templates.
+//
+// It papers over the differences between html/template and text/template,
+// which have the same methods but different types.
+type namespace interface {
+	AddParseTree(name string, tree *parse.Tree) error
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+	Clone() (namespace, error)
+	Funcs(funcs template.FuncMap)
+	// tree returns the parse tree of the named template, or nil if there is
+	// no such template.
+	tree(name string) *parse.Tree
+	// trees returns the parse tree of every template, keyed by name.
+	trees() map[string]*parse.Tree
+}
+
+// newNamespace creates an empty namespace. If text is true, templates in the
+// namespace are not escaped for HTML.
+func newNamespace(text bool, funcs template.FuncMap, options []string) namespace {
+	if text {
+		t := texttemplate.New("master")
+		if len(funcs) > 0 {
+			t.Funcs(texttemplate.FuncMap(funcs))
+		}
+		if len(options) > 0 {
+			t.Option(options...)
+		}
+		return textNamespace{t}
+	}
+
+	t := template.New("master")
+	if len(funcs) > 0 {
+		t.Funcs(funcs)
+	}
+	if len(options) > 0 {
+		t.Option(options...)
+	}
+	return htmlNamespace{t}
+}
+
+// parseTrees parses src and returns the parse tree of each template it
+// defines, keyed by template name. The template for src itself is named
+// name.
+//
+// Parsing is the same for HTML and text templates (escaping happens later),
+// so the results can be added to either kind of namespace.
+func parseTrees(name, src string, funcs template.FuncMap) (map[string]*parse.Tree, error) {
+	t := texttemplate.New(name)
+	if len(funcs) > 0 {
+		t.Funcs(texttemplate.FuncMap(funcs))
+	}
+	if _, err := t.Parse(src); err != nil {
+		return nil, err
+	}
+	trees := map[string]*parse.Tree{}
+	for _, tpl := range t.Templates() {
+		trees[tpl.Name()] = tpl.Tree
+	}
+	return trees, nil
+}
+
+type htmlNamespace struct {
+	*template.Template
+}
+
+func (n htmlNamespace) AddParseTree(name string, tree *parse.Tree) error {
+	_, err := n.Template.AddParseTree(name, tree)
+	return err
+}
+
+func (n htmlNamespace) Clone() (namespace, error) {
+	t, err := n.Template.Clone()
+	return htmlNamespace{t}, err
+}
+
+func (n htmlNamespace) Funcs(funcs template.FuncMap) {
+	n.Template.Funcs(funcs)
+}
+
+func (n htmlNamespace) tree(name string) *parse.Tree {
+	if t := n.Lookup(name); t != nil {
+		return t.Tree
+	}
+	return nil
+}
+
+func (n htmlNamespace) trees() map[string]*parse.Tree {
+	trees := map[string]*parse.Tree{}
+	for _, t := range n.Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
+
+type textNamespace struct {
+	*texttemplate.Template
+}
+
+func (n textNamespace) AddParseTree(name string, tree *parse.Tree) error {
+	_, err := n.Template.AddParseTree(name, tree)
+	return err
+}
+
+func (n textNamespace) Clone() (namespace, error) {
+	t, err := n.Template.Clone()
+	return textNamespace{t}, err
+}
+
+func (n textNamespace) Funcs(funcs template.FuncMap) {
+	n.Template.Funcs(texttemplate.FuncMap(funcs))
+}
+
+func (n textNamespace) tree(name string) *parse.Tree {
+	if t := n.Lookup(name); t != nil {
+		return t.Tree
+	}
+	return nil
+}
+
+func (n textNamespace) trees() map[string]*parse.Tree {
+	trees := map[string]*parse.Tree{}
+	for _, t := range n.Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
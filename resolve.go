@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Candidate is a place where the engine looked for a template or asset.
+type Candidate struct {
+	// Theme is the theme that was searched.
+	Theme string
+	// Path is the file that would supply the name in Theme. For named
+	// templates, it is the file containing the define, and is empty if
+	// Theme has no such define.
+	Path string
+	// Exists indicates that Theme has the template or asset.
+	Exists bool
+	// Chosen indicates that this is the candidate that is used.
+	Chosen bool
+}
+
+// Resolve explains how a template name is resolved. It returns one
+// Candidate per theme, in search order, noting which themes have the
+// template and which one wins.
+//
+// Like Render, names beginning with NamedTemplateSeparator refer to
+// templates made with define. If no theme has the template, the candidates
+// are returned along with NoTemplateFound.
+func (e *Engine) Resolve(name string) ([]Candidate, error) {
+	set := e.templates()
+	res := make([]Candidate, len(set.dirs))
+	found := false
+
+	if strings.HasPrefix(name, NamedTemplateSeparator) {
+		var chosen string
+		for _, sp := range set.spaces {
+			if d, ok := sp.named[name[1:]]; ok {
+				chosen = d
+				break
+			}
+		}
+		for i, d := range set.dirs {
+			res[i].Theme = d
+			for k := range set.cache[d] {
+				if strings.HasSuffix(k, name) {
+					res[i].Path = filepath.Join(d, strings.TrimSuffix(k, name))
+					res[i].Exists = true
+					break
+				}
+			}
+			res[i].Chosen = res[i].Exists && d == chosen
+			found = found || res[i].Chosen
+		}
+	} else {
+		n := filepath.Clean(name)
+		for i, d := range set.dirs {
+			res[i].Theme = d
+			res[i].Path = filepath.Join(d, n)
+			res[i].Exists = set.cache[d][n]
+			res[i].Chosen = res[i].Exists && !found
+			found = found || res[i].Exists
+		}
+	}
+
+	if !found {
+		return res, NoTemplateFound
+	}
+	return res, nil
+}
+
+// ResolveAsset explains how an asset name is resolved. It returns one
+// Candidate per theme, in search order, noting which themes have the asset
+// and which one wins.
+//
+// If no theme has the asset, the candidates are returned along with
+// NoAssetFound. Names that may not be fetched as assets return IllegalName.
+func (e *Engine) ResolveAsset(name string) ([]Candidate, error) {
+	name = filepath.Clean(name)
+	if !legalName(name) || e.isTemplate(name) {
+		return nil, IllegalName
+	}
+
+	set := e.templates()
+	res := make([]Candidate, len(set.dirs))
+	found := false
+	n := fsName(name)
+	for i, d := range set.dirs {
+		res[i].Theme = d
+		res[i].Path = filepath.Join(d, name)
+		_, err := fs.Stat(set.fsys[d], n)
+		res[i].Exists = err == nil
+		res[i].Chosen = res[i].Exists && !found
+		found = found || res[i].Exists
+	}
+
+	if !found {
+		return res, NoAssetFound
+	}
+	return res, nil
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResolve(t *testing.T) {
+	child := fstest.MapFS{
+		"main.tpl":      {Data: []byte(`child {{template "name" .}}`)},
+		"site.css":      {Data: []byte(`body{}`)},
+		"plain.txt.tpl": {Data: []byte(`plain`)},
+	}
+	parent := fstest.MapFS{
+		"main.tpl":  {Data: []byte(`parent`)},
+		"names.tpl": {Data: []byte(`{{define "name"}}parent{{end}}`)},
+		"site.css":  {Data: []byte(`body{}`)},
+		"logo.png":  {Data: []byte(`png`)},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		expect []Candidate
+		err    error
+	}{
+		{"main.tpl", []Candidate{
+			{"fs0", "fs0/main.tpl", true, true},
+			{"fs1", "fs1/main.tpl", true, false},
+		}, nil},
+		{"names.tpl", []Candidate{
+			{"fs0", "fs0/names.tpl", false, false},
+			{"fs1", "fs1/names.tpl", true, true},
+		}, nil},
+		{"#name", []Candidate{
+			{"fs0", "", false, false},
+			{"fs1", "fs1/names.tpl", true, true},
+		}, nil},
+		{"nope.tpl", []Candidate{
+			{"fs0", "fs0/nope.tpl", false, false},
+			{"fs1", "fs1/nope.tpl", false, false},
+		}, NoTemplateFound},
+	}
+	for _, tt := range tests {
+		res, err := e.Resolve(tt.name)
+		if err != tt.err {
+			t.Errorf("Resolve(%q): expected error %v, got %v", tt.name, tt.err, err)
+		}
+		if !reflect.DeepEqual(res, tt.expect) {
+			t.Errorf("Resolve(%q): expected %v, got %v", tt.name, tt.expect, res)
+		}
+	}
+
+	res, err := e.ResolveAsset("/site.css")
+	if err != nil {
+		t.Errorf("Failed to resolve asset: %s", err)
+	}
+	expect := []Candidate{
+		{"fs0", "fs0/site.css", true, true},
+		{"fs1", "fs1/site.css", true, false},
+	}
+	if !reflect.DeepEqual(res, expect) {
+		t.Errorf("Expected %v, got %v", expect, res)
+	}
+	if res, _ := e.ResolveAsset("logo.png"); len(res) != 2 || res[0].Exists || !res[1].Chosen {
+		t.Errorf("Expected logo.png from fs1, got %v", res)
+	}
+	if _, err := e.ResolveAsset("nope.png"); err != NoAssetFound {
+		t.Errorf("Expected NoAssetFound, got %v", err)
+	}
+	if _, err := e.ResolveAsset("main.tpl"); err != IllegalName {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	mem := fstest.MapFS{
+		"main.tpl":         {Data: []byte(`<p>{{template "fs0/part.tpl"}}</p>`)},
+		"part.tpl":         {Data: []byte(`part`)},
+		"plain.txt.tpl":    {Data: []byte(`plain`)},
+		"page.tpl":         {Data: []byte(`{{define "content"}}page{{end}}`)},
+		"layouts/base.tpl": {Data: []byte(`<main>{{block "content" .}}{{end}}</main>`)},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	expectRender(t, e, "main.tpl", "<p>part</p>")
+
+	e.Debug = true
+	expectRender(t, e, "main.tpl", "<!-- engine: fs0/main.tpl --><p><!-- engine: fs0/part.tpl -->part<!-- /engine: fs0/part.tpl --></p><!-- /engine: fs0/main.tpl -->")
+	expectRender(t, e, "plain.txt.tpl", "plain")
+
+	out, err := e.RenderWithLayout("page.tpl", "layouts/base.tpl", nil)
+	if err != nil {
+		t.Fatalf("Failed render: %s", err)
+	}
+	expect := "<!-- engine: fs0/page.tpl in fs0/layouts/base.tpl --><main><!-- engine: content -->page<!-- /engine: content --></main><!-- /engine: fs0/page.tpl in fs0/layouts/base.tpl -->"
+	if out != expect {
+		t.Errorf("Expected %q, got %q", expect, out)
+	}
+
+	e.Debug = false
+	expectRender(t, e, "main.tpl", "<p>part</p>")
+}
+
+func TestDebugNested(t *testing.T) {
+	mem := fstest.MapFS{
+		"main.tpl": {Data: []byte(`{{define "item"}}<li>{{.}}</li>{{end}}` +
+			`<ul>{{range .}}{{template "item" .}}{{end}}</ul>` +
+			`<a title="{{template "title"}}">a</a>` +
+			`<script>var x = {{template "value"}};</script>` +
+			`{{template "fs0/part.tpl"}}`)},
+		"part.tpl":  {Data: []byte(`{{define "title"}}t{{end}}{{define "value"}}{{1}}{{end}}<b>{{template "bold--it"}}</b>`)},
+		"names.tpl": {Data: []byte(`{{define "bold--it"}}b{{end}}`)},
+	}
+	e, err := NewEngineFS([]fs.FS{mem}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	e.Debug = true
+
+	out, err := e.Render("main.tpl", []int{1, 2})
+	if err != nil {
+		t.Fatalf("Failed render: %s", err)
+	}
+	expect := "<!-- engine: fs0/main.tpl -->" +
+		"<ul><!-- engine: item --><li>1</li><!-- /engine: item --><!-- engine: item --><li>2</li><!-- /engine: item --></ul>" +
+		`<a title="t">a</a>` +
+		"<script>var x =  1 ;</script>" +
+		"<!-- engine: fs0/part.tpl --><b><!-- engine: bold- -it -->b<!-- /engine: bold- -it --></b><!-- /engine: fs0/part.tpl -->" +
+		"<!-- /engine: fs0/main.tpl -->"
+	if out != expect {
+		t.Errorf("Expected %q, got %q", expect, out)
+	}
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// SuggestionSeparator separates the parts of a name generated by Suggestions.
+var SuggestionSeparator = "--"
+
+// compoundExts are the extensions that mark the kind of a template when they
+// come before its template extension, as in page.txt.tpl.
+var compoundExts = []string{".txt", ".html", ".htm", ".md"}
+
+// Suggestions generates a list of candidate template names, from most to
+// least specific.
+//
+// Each qualifier narrows the name further. For example:
+//
+//	Suggestions("node.tpl", "article", "42")
+//
+// returns
+//
+//	[]string{"node--article--42.tpl", "node--article.tpl", "node.tpl"}
+//
+// Qualifiers go before the whole extension, so the kinds of template marked
+// by a second extension are kept: Suggestions("mail.txt.tpl", "welcome")
+// starts with "mail--welcome.txt.tpl". See compoundExts.
+//
+// The result is suitable for passing to RenderFirst.
+func Suggestions(base string, qualifiers ...string) []string {
+	ext := filepath.Ext(base)
+	if inner := filepath.Ext(strings.TrimSuffix(base, ext)); contains(compoundExts, inner) {
+		ext = inner + ext
+	}
+	stem := strings.TrimSuffix(base, ext)
+
+	res := make([]string, len(qualifiers)+1)
+	for i := len(qualifiers); i >= 0; i-- {
+		parts := append([]string{stem}, qualifiers[:i]...)
+		res[len(qualifiers)-i] = strings.Join(parts, SuggestionSeparator) + ext
+	}
+	return res
+}
+
+// First returns the first of the given names that refers to a template.
+//
+// Each name is looked up just as it is by Render, so each one is checked
+// against every theme before moving on to the next. If none of the names
+// refer to a template, NoTemplateFound is returned.
+func (e *Engine) First(names []string) (string, error) {
+	return e.first(e.templates(), names)
+}
+
+// first is First with the templates in set.
+func (e *Engine) first(set *templateSet, names []string) (string, error) {
+	for _, n := range names {
+		if _, _, err := e.lookup(set, n); err == nil {
+			return n, nil
+		}
+	}
+	return "", NoTemplateFound
+}
+
+// RenderFirst renders the first of the given names that refers to a template.
+//
+// Along with the output, it returns the name that was chosen, which is
+// useful when debugging why a particular template was or wasn't used. See
+// First and Suggestions.
+func (e *Engine) RenderFirst(names []string, data interface{}) (string, string, error) {
+	// The same templates are used throughout, so a reload can't change
+	// which template the name refers to.
+	set := e.templates()
+	n, err := e.first(set, names)
+	if err != nil {
+		return "", "", err
+	}
+	var buf bytes.Buffer
+	err = e.renderTo(&buf, set, n, data)
+	return buf.String(), n, err
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSuggestions(t *testing.T) {
+	data := []struct {
+		base   string
+		quals  []string
+		expect []string
+	}{
+		{"node.tpl", nil, []string{"node.tpl"}},
+		{"node.tpl", []string{"article"}, []string{"node--article.tpl", "node.tpl"}},
+		{"node.tpl", []string{"article", "42"}, []string{
+			"node--article--42.tpl",
+			"node--article.tpl",
+			"node.tpl",
+		}},
+		{"nodes/node", []string{"article"}, []string{"nodes/node--article", "nodes/node"}},
+		{"mail.txt.tpl", []string{"welcome"}, []string{"mail--welcome.txt.tpl", "mail.txt.tpl"}},
+		{"mail.html.tpl", []string{"welcome"}, []string{"mail--welcome.html.tpl", "mail.html.tpl"}},
+		{"docs/page.md.tpl", []string{"intro"}, []string{"docs/page--intro.md.tpl", "docs/page.md.tpl"}},
+		{"v1.2/node.tpl", []string{"x"}, []string{"v1.2/node--x.tpl", "v1.2/node.tpl"}},
+		{"jquery.min.js", []string{"x"}, []string{"jquery.min--x.js", "jquery.min.js"}},
+	}
+
+	for _, d := range data {
+		if out := Suggestions(d.base, d.quals...); !reflect.DeepEqual(out, d.expect) {
+			t.Errorf("Expected %v, got %v", d.expect, out)
+		}
+	}
+}
+
+func TestRenderFirst(t *testing.T) {
+	child := fstest.MapFS{
+		"node--article.tpl": {Data: []byte("article:{{.}}")},
+	}
+	parent := fstest.MapFS{
+		"node--article--42.tpl": {Data: []byte("article 42:{{.}}")},
+		"node.tpl":              {Data: []byte("node:{{.}}")},
+	}
+	e, err := NewEngineFS([]fs.FS{child, parent}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	data := []struct {
+		names  []string
+		chosen string
+		out    string
+	}{
+		{Suggestions("node.tpl", "article", "42"), "node--article--42.tpl", "article 42:test"},
+		{Suggestions("node.tpl", "article", "43"), "node--article.tpl", "article:test"},
+		{Suggestions("node.tpl", "page"), "node.tpl", "node:test"},
+	}
+	for _, d := range data {
+		out, chosen, err := e.RenderFirst(d.names, "test")
+		if err != nil {
+			t.Errorf("Failed render of %v: %s", d.names, err)
+		}
+		if chosen != d.chosen {
+			t.Errorf("Expected %s to be chosen, got %s", d.chosen, chosen)
+		}
+		if out != d.out {
+			t.Errorf("Expected %q, got %q", d.out, out)
+		}
+	}
+
+	if _, _, err := e.RenderFirst([]string{"a.tpl", "b.tpl"}, nil); err != NoTemplateFound {
+		t.Errorf("Expected NoTemplateFound, got %v", err)
+	}
+}
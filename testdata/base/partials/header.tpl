@@ -0,0 +1 @@
+BASE HEADER:{{.}}
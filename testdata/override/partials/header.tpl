@@ -0,0 +1 @@
+OVERRIDE HEADER:{{.}}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/sprig"
+)
+
+// ManifestName is the name of the optional manifest file in a theme directory.
+var ManifestName = "theme.json"
+
+// ThemeCycle indicates that a chain of parent themes loops back on itself.
+var ThemeCycle = errors.New("theme inherits from itself")
+
+// Theme describes a theme.
+//
+// A theme may describe itself with a manifest, which is a JSON file named
+// ManifestName at the root of the theme directory:
+//
+//	{
+//		"name": "pretty",
+//		"version": "1.0.0",
+//		"description": "A pretty theme.",
+//		"parent": "default",
+//		"settings": {"color": "pink"}
+//	}
+//
+// All fields are optional.
+type Theme struct {
+	// Dir is the theme's entry in Engine.Dirs. It is not read from the
+	// manifest.
+	Dir string `json:"-"`
+
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	// Parent is the name of the theme that this theme extends. It is used
+	// by NewFromTheme.
+	Parent string `json:"parent"`
+	// Settings are default settings supplied by the theme.
+	Settings map[string]interface{} `json:"settings"`
+	// Bundles declares bundles of assets. See Engine.Bundle.
+	Bundles map[string][]string `json:"bundles"`
+}
+
+// NewFromTheme creates a new *Engine from a theme and all of its parents.
+//
+// The root is a directory containing theme directories, and name is the
+// directory of the theme to use. If the theme's manifest names a parent,
+// that theme is loaded from root as well, and so on up the chain. The named
+// theme takes precedence over its parent, which takes precedence over its
+// own parent.
+//
+// If the chain of parents loops back on itself, the returned error wraps
+// ThemeCycle.
+//
+// Like New, this enables the Sprig functions.
+func NewFromTheme(root, name string) (*Engine, error) {
+	chain, err := themeChain(os.DirFS(root), name)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(chain))
+	for i, n := range chain {
+		paths[i] = filepath.Join(root, n)
+	}
+	return NewEngine(paths, sprig.FuncMap(), []string{})
+}
+
+// AddTheme adds a theme whose files are held in memory.
+//
+// The files map slash-separated paths, like "partials/header.tpl", to their
+// contents. Templates and assets alike take part in the cascade as they would
+// in a theme on disk, so an added theme can override or supply templates,
+// named templates, and assets. A theme manifest may be included, too.
+//
+// The theme is inserted into the list of themes at the given position: 0
+// adds it at the top, where it overrides every other theme, and len(Dirs())
+// adds it at the bottom, where it supplies defaults. Positions outside of
+// that range are moved to the nearest end.
+//
+// The name identifies the theme in Dirs, Paths, and the like. It must not
+// already be in use. All templates are reparsed; if that fails, the theme is
+// not added.
+func (e *Engine) AddTheme(name string, files map[string]string, position int) error {
+	if name == "" || !legalName(name) {
+		return IllegalName
+	}
+	for p := range files {
+		if !fs.ValidPath(p) || !legalName(p) || p == "." {
+			return fmt.Errorf("%w: %s", IllegalName, p)
+		}
+		// A file can't also be a directory.
+		for d := path.Dir(p); d != "."; d = path.Dir(d) {
+			if _, ok := files[d]; ok {
+				return fmt.Errorf("%w: %s is a file", IllegalName, d)
+			}
+		}
+	}
+
+	e.updateMx.Lock()
+	defer e.updateMx.Unlock()
+
+	e.mx.RLock()
+	olddirs, oldfsys, exts := e.dirs, e.fsys, e.exts
+	e.mx.RUnlock()
+
+	if _, ok := oldfsys[name]; ok {
+		return fmt.Errorf("theme %s already exists", name)
+	}
+	if position < 0 {
+		position = 0
+	} else if position > len(olddirs) {
+		position = len(olddirs)
+	}
+
+	dirs := make([]string, 0, len(olddirs)+1)
+	dirs = append(dirs, olddirs[:position]...)
+	dirs = append(dirs, name)
+	dirs = append(dirs, olddirs[position:]...)
+	fsys := make(map[string]fs.FS, len(oldfsys)+1)
+	for k, v := range oldfsys {
+		fsys[k] = v
+	}
+	fsys[name] = newMemFS(files)
+
+	set, err := e.parse(dirs, fsys, exts)
+	if err != nil {
+		return err
+	}
+	e.mx.Lock()
+	e.dirs, e.fsys, e.set = dirs, fsys, set
+	e.mx.Unlock()
+	return nil
+}
+
+// Themes returns a description of each theme, in the order that the themes
+// are searched.
+//
+// A theme without a manifest is named after its directory.
+func (e *Engine) Themes() []*Theme {
+	themes := e.templates().themes
+	res := make([]*Theme, len(themes))
+	copy(res, themes)
+	return res
+}
+
+// Setting returns the value of the named setting from the first theme that
+// supplies it.
+func (e *Engine) Setting(name string) (interface{}, bool) {
+	for _, t := range e.Themes() {
+		if v, ok := t.Settings[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// themeChain returns the names of the theme directories in root that make up
+// the named theme, starting with the theme itself.
+func themeChain(root fs.FS, name string) ([]string, error) {
+	var chain []string
+	seen := map[string]bool{}
+	for name != "" {
+		if !legalThemeName(name) {
+			return nil, IllegalName
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s", ThemeCycle, strings.Join(append(chain, name), " -> "))
+		}
+		seen[name] = true
+
+		fi, err := fs.Stat(root, name)
+		if err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("could not read theme '%s'", name)
+		}
+		chain = append(chain, name)
+
+		sub, err := fs.Sub(root, name)
+		if err != nil {
+			return nil, err
+		}
+		t, err := readManifest(sub)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", path.Join(name, ManifestName), err)
+		}
+		name = t.Parent
+	}
+	return chain, nil
+}
+
+// legalThemeName returns true if name refers to a directory directly inside
+// of a theme root.
+func legalThemeName(name string) bool {
+	return legalName(name) && fs.ValidPath(name) && !strings.Contains(name, "/") && name != "."
+}
+
+// readManifest reads the manifest from a theme.
+//
+// If the theme has no manifest, an empty Theme is returned.
+func readManifest(fsys fs.FS) (*Theme, error) {
+	t := &Theme{}
+	data, err := fs.ReadFile(fsys, ManifestName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return t, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewFromTheme(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"pretty", "default", "ugly"} {
+		if err := os.Mkdir(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(root, "pretty", ManifestName), `{
+		"name": "Pretty",
+		"version": "1.2.3",
+		"parent": "default",
+		"settings": {"color": "pink"}
+	}`)
+	writeFile(t, filepath.Join(root, "pretty", "main.tpl"), "pretty:{{.}}")
+	writeFile(t, filepath.Join(root, "default", "main.tpl"), "default:{{.}}")
+	writeFile(t, filepath.Join(root, "default", "duckling.tpl"), "duckling:{{.}}")
+	writeFile(t, filepath.Join(root, "default", ManifestName), `{
+		"description": "The default theme.",
+		"settings": {"color": "gray", "size": 12}
+	}`)
+	writeFile(t, filepath.Join(root, "ugly", "main.tpl"), "ugly:{{.}}")
+
+	e, err := NewFromTheme(root, "pretty")
+	if err != nil {
+		t.Fatalf("Failed to load theme: %s", err)
+	}
+	expectRender(t, e, "main.tpl", "pretty:test")
+	expectRender(t, e, "duckling.tpl", "duckling:test")
+
+	themes := e.Themes()
+	if len(themes) != 2 {
+		t.Fatalf("Expected 2 themes, got %d", len(themes))
+	}
+	if themes[0].Name != "Pretty" || themes[0].Version != "1.2.3" || themes[0].Dir != filepath.Join(root, "pretty") {
+		t.Errorf("Unexpected theme: %+v", themes[0])
+	}
+	if themes[1].Name != "default" || themes[1].Description != "The default theme." {
+		t.Errorf("Unexpected theme: %+v", themes[1])
+	}
+
+	if v, ok := e.Setting("color"); !ok || v != "pink" {
+		t.Errorf("Expected color pink, got %v", v)
+	}
+	if v, ok := e.Setting("size"); !ok || v != 12.0 {
+		t.Errorf("Expected size 12, got %v", v)
+	}
+	if _, ok := e.Setting("nope"); ok {
+		t.Error("Expected no setting")
+	}
+
+	// A theme without a manifest stands alone.
+	e, err = NewFromTheme(root, "ugly")
+	if err != nil {
+		t.Fatalf("Failed to load theme: %s", err)
+	}
+	if len(e.Dirs()) != 1 {
+		t.Errorf("Expected 1 dir, got %v", e.Dirs())
+	}
+
+	if _, err := NewFromTheme(root, "../pretty"); err != IllegalName {
+		t.Errorf("Expected IllegalName, got %v", err)
+	}
+	if _, err := NewFromTheme(root, "nope"); err == nil {
+		t.Error("Expected a missing theme to fail")
+	}
+}
+
+func TestThemeCycle(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a", "b", "c"} {
+		if err := os.Mkdir(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(root, "a", ManifestName), `{"parent": "b"}`)
+	writeFile(t, filepath.Join(root, "b", ManifestName), `{"parent": "c"}`)
+	writeFile(t, filepath.Join(root, "c", ManifestName), `{"parent": "a"}`)
+
+	_, err := NewFromTheme(root, "a")
+	if !errors.Is(err, ThemeCycle) {
+		t.Errorf("Expected ThemeCycle, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// WatchInterval is the default polling interval used by Watch.
+var WatchInterval = time.Second
+
+// Watch polls the theme directories for changes to templates.
+//
+// Every interval, each theme is scanned for templates. If any template has
+// been added, removed, or modified since the last scan, all templates are
+// reparsed with Reload. Calls to Render always see either the old or the new
+// set of templates, never a partially built one.
+//
+// If reparsing fails, the previously loaded templates remain in use, and the
+// error is passed to onError. onError may be nil, in which case errors are
+// ignored. Errors encountered while scanning are reported the same way.
+//
+// If interval is less than or equal to zero, WatchInterval is used.
+//
+// Watching is intended for development. It returns a function that stops
+// the watcher.
+func (e *Engine) Watch(interval time.Duration, onError func(error)) (stop func()) {
+	if interval <= 0 {
+		interval = WatchInterval
+	}
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	last, err := e.snapshot()
+	if err != nil {
+		onError(err)
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			snap, err := e.snapshot()
+			if err != nil {
+				onError(err)
+				continue
+			}
+			if snap.equal(last) {
+				continue
+			}
+			// Even if the reload fails, we record the new snapshot so that
+			// the same broken file doesn't get reported on every tick.
+			last = snap
+			if err := e.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// fileStamp records enough about a file to tell whether it has changed.
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// snapshot maps template paths to their stamps.
+type snapshot map[string]fileStamp
+
+func (s snapshot) equal(o snapshot) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for k, v := range s {
+		if ov, ok := o[k]; !ok || !ov.mod.Equal(v.mod) || ov.size != v.size {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot stats every template in every theme.
+func (e *Engine) snapshot() (snapshot, error) {
+	snap := snapshot{}
+	e.mx.RLock()
+	dirs, fsys, exts := e.dirs, e.fsys, e.exts
+	e.mx.RUnlock()
+	for _, d := range dirs {
+		files, err := findTemplates(fsys[d], exts)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			fi, err := fs.Stat(fsys[d], f)
+			if err != nil {
+				return nil, err
+			}
+			snap[filepath.Join(d, filepath.FromSlash(f))] = fileStamp{fi.ModTime(), fi.Size()}
+		}
+	}
+	return snap, nil
+}
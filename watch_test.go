@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	tpl := filepath.Join(dir, "page.tpl")
+	writeFile(t, tpl, "one:{{.}}")
+
+	e, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+	expectRender(t, e, "page.tpl", "one:test")
+
+	writeFile(t, tpl, "two:{{.}}")
+	if err := e.Reload(); err != nil {
+		t.Fatalf("Failed reload: %s", err)
+	}
+	expectRender(t, e, "page.tpl", "two:test")
+
+	// A broken template leaves the last good set in place.
+	writeFile(t, tpl, "three:{{.")
+	if err := e.Reload(); err == nil {
+		t.Error("Expected reload of a broken template to fail")
+	}
+	expectRender(t, e, "page.tpl", "two:test")
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "page.tpl"), "one:{{.}}")
+
+	e, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %s", err)
+	}
+
+	errs := make(chan error, 10)
+	stop := e.Watch(5*time.Millisecond, func(err error) { errs <- err })
+	defer stop()
+
+	writeFile(t, filepath.Join(dir, "added.tpl"), "added:{{.}}")
+	waitFor(t, func() bool {
+		out, err := e.Render("added.tpl", "test")
+		return err == nil && strings.TrimSpace(out) == "added:test"
+	})
+
+	writeFile(t, filepath.Join(dir, "added.tpl"), "broken:{{.")
+	select {
+	case <-errs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a parse error to be reported")
+	}
+	expectRender(t, e, "added.tpl", "added:test")
+
+	if err := os.Remove(filepath.Join(dir, "added.tpl")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		_, err := e.Render("added.tpl", "test")
+		return err == NoTemplateFound
+	})
+}
+
+// writes counts calls to writeFile.
+var writes int
+
+func writeFile(t *testing.T, name, data string) {
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the modification is visible even on file systems with a
+	// coarse timestamp resolution.
+	writes++
+	future := time.Now().Add(time.Duration(writes) * time.Second)
+	if err := os.Chtimes(name, future, future); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the templates to reload")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func expectRender(t *testing.T, e *Engine, name, expect string) {
+	out, err := e.Render(name, "test")
+	if err != nil {
+		t.Errorf("Failed render of %s: %s", name, err)
+	}
+	if out = strings.TrimSpace(out); out != expect {
+		t.Errorf("Expected %q, got %q", expect, out)
+	}
+}